@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	acpidSocket    = "/run/acpid.socket"
+	procACPIEvents = "/proc/acpi/event"
+)
+
+// watchACPIEvents sends an empty name, standing for every power supply, to
+// names whenever ACPI reports a battery or AC adapter event, until ctx is done.
+// Events are read from acpid, or from the kernel when acpid is not running.
+func watchACPIEvents(ctx context.Context, names chan<- string) error {
+	var events io.ReadCloser
+	conn, err := net.Dial("unix", acpidSocket)
+	if err == nil {
+		events = conn
+	} else {
+		f, ferr := os.Open(procACPIEvents)
+		if ferr != nil {
+			return fmt.Errorf("reading ACPI events: %w", errors.Join(err, ferr))
+		}
+		events = f
+	}
+
+	go func() {
+		<-ctx.Done()
+		events.Close()
+	}()
+
+	go func() {
+		scanner := bufio.NewScanner(events)
+		for scanner.Scan() {
+			// Events look like "battery PNP0C0A:00 00000080 00000001".
+			class, _, _ := strings.Cut(scanner.Text(), " ")
+			if !isPowerEvent(class) {
+				continue
+			}
+			select {
+			case names <- "":
+			default:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// isPowerEvent reports whether ACPI events of class, such as "battery" or
+// "ac_adapter", may change the batteries.
+func isPowerEvent(class string) bool {
+	class, _, _ = strings.Cut(class, "/")
+	return class == "battery" || class == "ac_adapter"
+}
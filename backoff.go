@@ -0,0 +1,34 @@
+package main
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// backoff computes the delays between reconnection attempts, doubling from
+// base up to max. Each delay is jittered between half and all of its value
+// so that clients do not retry in lockstep.
+type backoff struct {
+	base    time.Duration
+	max     time.Duration
+	attempt int
+
+	// jitter returns a number in [0, 1). It defaults to rand.Float64 and is
+	// replaceable for deterministic sequences.
+	jitter func() float64
+}
+
+// next returns the delay before the next attempt.
+func (b *backoff) next() time.Duration {
+	delay := b.max
+	if b.attempt < 32 {
+		delay = min(b.base<<b.attempt, b.max)
+	}
+	b.attempt++
+
+	jitter := b.jitter
+	if jitter == nil {
+		jitter = rand.Float64
+	}
+	return delay/2 + time.Duration(jitter()*float64(delay/2))
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		jitter float64
+		want   []time.Duration
+	}{
+		{0, []time.Duration{
+			500 * time.Millisecond, time.Second, 2 * time.Second, 4 * time.Second,
+			8 * time.Second, 15 * time.Second, 15 * time.Second,
+		}},
+		{0.5, []time.Duration{
+			750 * time.Millisecond, 1500 * time.Millisecond, 3 * time.Second, 6 * time.Second,
+			12 * time.Second, 22500 * time.Millisecond, 22500 * time.Millisecond,
+		}},
+		{0.999, []time.Duration{
+			999500 * time.Microsecond, 1999 * time.Millisecond, 3998 * time.Millisecond, 7996 * time.Millisecond,
+			15992 * time.Millisecond, 29985 * time.Millisecond, 29985 * time.Millisecond,
+		}},
+	}
+
+	for _, tt := range tests {
+		b := backoff{base: time.Second, max: 30 * time.Second, jitter: func() float64 { return tt.jitter }}
+		for i, want := range tt.want {
+			if got := b.next(); got != want {
+				t.Errorf("with jitter %g, delay %d = %s, want %s", tt.jitter, i+1, got, want)
+			}
+		}
+	}
+}
+
+func TestBackoffCapsLongRuns(t *testing.T) {
+	b := backoff{base: time.Second, max: 30 * time.Second, jitter: func() float64 { return 0 }}
+	for range 100 {
+		if got := b.next(); got > 30*time.Second || got <= 0 {
+			t.Fatalf("delay %s out of (0, 30s]", got)
+		}
+	}
+}
+
+func TestReconnectWaitsOnClock(t *testing.T) {
+	clk := newFakeClock(time.Now())
+	ctx, cancel := context.WithCancel(t.Context())
+
+	done := make(chan error)
+	go func() {
+		_, err := reconnectSystemBus(ctx, &config{reconnectMax: 30 * time.Second}, clk)
+		done <- err
+	}()
+
+	// The first attempt waits between half a second and a second, unless the
+	// context is done first.
+	waitForWaiters(t, clk, 1)
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("reconnectSystemBus() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reconnectSystemBus did not return once the context was done")
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	// kdMkTone is the ioctl of the Linux console sounding the PC speaker.
+	kdMkTone = 0x4B30
+
+	beepFrequency = 880
+	beepLength    = 200 * time.Millisecond
+)
+
+// beep sounds the PC speaker through the Linux console, falling back to the
+// terminal bell. Opening the console needs root or CAP_SYS_TTY_CONFIG.
+func beep() error {
+	f, err := os.OpenFile("/dev/console", os.O_WRONLY|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The argument is the length in milliseconds in the high word and the
+	// period in ticks of the 1.19 MHz timer in the low one.
+	tone := uintptr(beepLength.Milliseconds())<<16 | 1193180/beepFrequency
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), kdMkTone, tone); errno == 0 {
+		return nil
+	}
+
+	_, err = f.Write([]byte("\a"))
+	return err
+}
+
+// startBeep beeps every beep interval until stopBeep is called for d, as a
+// last resort on machines without a notification daemon.
+func (m *monitor) startBeep(ctx context.Context, d *device) {
+	if d.stopBeep != nil {
+		return
+	}
+
+	// The config of the monitor is swapped by the main loop, so it is not
+	// read from the goroutine.
+	ctx, d.stopBeep = context.WithCancel(ctx)
+	ticker := m.clock.NewTicker(m.cfg.beepInterval)
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			if err := beep(); err != nil {
+				slog.Error(err.Error())
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.Chan():
+			}
+		}
+	}()
+}
+
+// stopBeep stops the beeping started by startBeep for d, if any.
+func (m *monitor) stopBeep(d *device) {
+	if d.stopBeep != nil {
+		d.stopBeep()
+		d.stopBeep = nil
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/esiqveland/notify"
+)
+
+// runDumpCapabilities prints the capabilities advertised by the notification
+// server, one per line, so users can tell which features it will render.
+func runDumpCapabilities(cfg *config) error {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	defer notifier.Close()
+
+	info, err := notifier.GetServerInformation()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("# %s %s (%s)\n", info.Name, info.Version, info.Vendor)
+
+	capabilities, err := notifier.GetCapabilities()
+	if err != nil {
+		return err
+	}
+	for _, capability := range capabilities {
+		fmt.Println(capability)
+	}
+
+	return nil
+}
+
+// valueCapabilities are advertised by the notification servers known to draw
+// the value hint as a progress bar, as no capability stands for the hint
+// itself.
+var valueCapabilities = []string{"x-canonical-private-synchronous", "x-kde-origin-name"}
+
+// capabilityGate is a feature only used when the notification server
+// advertises one of capabilities.
+type capabilityGate struct {
+	capabilities []string
+	feature      string
+	enabled      func(c *config) bool
+}
+
+var capabilityGates = []capabilityGate{
+	{[]string{"body-markup"}, "--markup", func(c *config) bool { return c.markup }},
+	{[]string{"sound"}, "--sound", func(c *config) bool { return len(c.sounds) > 0 }},
+	{valueCapabilities, "the value hint", func(c *config) bool { return !c.noValueHint }},
+}
+
+// readCapabilities reads the capabilities of the notification server behind
+// notifier into cfg, logging the features asked for that it does not support
+// and that are turned off. A notifier returning nil, like the portal, leaves
+// them unknown, so that every feature stays on.
+func readCapabilities(cfg *config, notifier notify.Notifier) error {
+	capabilities, err := notifier.GetCapabilities()
+	if err != nil {
+		return fmt.Errorf("reading notification server capabilities: %w", err)
+	}
+	if capabilities == nil {
+		cfg.capabilities = nil
+		return nil
+	}
+
+	cfg.capabilities = map[string]bool{}
+	for _, capability := range capabilities {
+		cfg.capabilities[capability] = true
+	}
+
+	for _, gate := range capabilityGates {
+		if gate.enabled(cfg) && !cfg.supports(gate.capabilities...) {
+			slog.Warn(fmt.Sprintf("The notification server does not support %s, turning off %s", strings.Join(gate.capabilities, " or "), gate.feature))
+		}
+	}
+	return nil
+}
+
+// supports reports whether the notification server advertises one of
+// capabilities, assuming it does until its capabilities are read.
+func (c *config) supports(capabilities ...string) bool {
+	return c.capabilities == nil || slices.ContainsFunc(capabilities, func(capability string) bool {
+		return c.capabilities[capability]
+	})
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// captureLogs makes the default logger write to the returned buffer until t
+// ends.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+	t.Cleanup(func() {
+		slog.SetDefault(logger)
+	})
+	return &buf
+}
+
+func TestReadCapabilities(t *testing.T) {
+	buf := captureLogs(t)
+	cfg := newTestConfig(t, "--markup")
+	if err := readCapabilities(cfg, &fakeNotifier{capabilities: []string{"body", "sound"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cfg.supports("sound") {
+		t.Error("supports(sound) = false, want true")
+	}
+	if cfg.supports("body-markup") {
+		t.Error("supports(body-markup) = true, want false")
+	}
+	if !strings.Contains(buf.String(), "turning off --markup") {
+		t.Errorf("logged %q, want --markup turned off", buf.String())
+	}
+	if !strings.Contains(buf.String(), "turning off the value hint") {
+		t.Errorf("logged %q, want the value hint turned off", buf.String())
+	}
+	notification := cfg.newNotification(eventLow, deviceTypeBattery, "Test", 20, 0)
+	if _, ok := notification.Hints["value"]; ok {
+		t.Error("the value hint is sent to a server not drawing it")
+	}
+}
+
+func TestReadCapabilitiesValue(t *testing.T) {
+	for _, capability := range valueCapabilities {
+		buf := captureLogs(t)
+		cfg := newTestConfig(t)
+		if err := readCapabilities(cfg, &fakeNotifier{capabilities: []string{"body", capability}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(buf.String(), "value hint") {
+			t.Errorf("with %s, logged %q, want the value hint kept", capability, buf.String())
+		}
+		notification := cfg.newNotification(eventLow, deviceTypeBattery, "Test", 20, 0)
+		if _, ok := notification.Hints["value"]; !ok {
+			t.Errorf("with %s, no value hint", capability)
+		}
+	}
+}
+
+func TestReadCapabilitiesUnknown(t *testing.T) {
+	buf := captureLogs(t)
+	cfg := newTestConfig(t, "--markup", "--backend", "portal")
+	if err := readCapabilities(cfg, &portalNotifier{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.capabilities != nil {
+		t.Errorf("capabilities = %v, want them unknown", cfg.capabilities)
+	}
+	if !cfg.supports("body-markup") {
+		t.Error("supports(body-markup) = false, want true while unknown")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("logged %q, want nothing turned off", buf.String())
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import "time"
+
+// clock tells the time to the monitor. Every time-based behavior goes through
+// it, so that a fake clock can drive repeats, windows and schedules.
+type clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) ticker
+}
+
+// ticker is a time.Ticker obtained from a clock.
+type ticker interface {
+	Chan() <-chan time.Time
+	Stop()
+}
+
+// systemClock is the clock of the system.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (systemClock) NewTicker(d time.Duration) ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTicker struct {
+	*time.Ticker
+}
+
+func (t systemTicker) Chan() <-chan time.Time {
+	return t.C
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only moves when advanced, firing the timers
+// and tickers that come due.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter is a pending After, or a ticker when period is set.
+type fakeWaiter struct {
+	at      time.Time
+	period  time.Duration
+	c       chan time.Time
+	stopped bool
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	return c.wait(d, 0).c
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) ticker {
+	return &fakeTicker{clock: c, waiter: c.wait(d, d)}
+}
+
+func (c *fakeClock) wait(d, period time.Duration) *fakeWaiter {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	w := &fakeWaiter{at: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	c.fire()
+	return w
+}
+
+// Advance moves the time forward by d, firing what came due. Like tickers of
+// the time package, a ticker not read in time drops ticks.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+func (c *fakeClock) fire() {
+	c.waiters = slices.DeleteFunc(c.waiters, func(w *fakeWaiter) bool {
+		for !w.stopped && !w.at.After(c.now) {
+			select {
+			case w.c <- w.at:
+			default:
+			}
+			if w.period == 0 {
+				return true
+			}
+			w.at = w.at.Add(w.period)
+		}
+		return w.stopped
+	})
+}
+
+// Waiters returns the number of pending timers and tickers, for tests to wait
+// until a goroutine is about to wait on the clock.
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// waitForWaiters blocks until c has n pending timers and tickers.
+func waitForWaiters(t *testing.T, c *fakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for c.Waiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d waiters on the clock, want %d", c.Waiters(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type fakeTicker struct {
+	clock  *fakeClock
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) Chan() <-chan time.Time {
+	return t.waiter.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.waiter.stopped = true
+	t.clock.fire()
+}
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	c := newFakeClock(start)
+
+	after := c.After(time.Minute)
+	tick := c.NewTicker(20 * time.Second)
+
+	c.Advance(30 * time.Second)
+	select {
+	case <-after:
+		t.Fatal("After fired before its time")
+	default:
+	}
+	if got := <-tick.Chan(); !got.Equal(start.Add(20 * time.Second)) {
+		t.Errorf("first tick at %s, want %s", got, start.Add(20*time.Second))
+	}
+
+	c.Advance(30 * time.Second)
+	if got := <-after; !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("After fired at %s, want %s", got, start.Add(time.Minute))
+	}
+
+	tick.Stop()
+	if n := c.Waiters(); n != 0 {
+		t.Errorf("got %d waiters after stopping the ticker, want 0", n)
+	}
+}
+
+func TestUntilDailySummary(t *testing.T) {
+	tests := []struct {
+		now  string
+		at   string
+		want time.Duration
+	}{
+		{"2024-05-01T19:30:00Z", "20:00", 30 * time.Minute},
+		{"2024-05-01T20:00:00Z", "20:00", 24 * time.Hour},
+		{"2024-05-01T21:15:00Z", "08:00", 10*time.Hour + 45*time.Minute},
+	}
+
+	for _, tt := range tests {
+		now, err := time.Parse(time.RFC3339, tt.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := &monitor{cfg: &config{dailySummaryAt: tt.at}, clock: newFakeClock(now)}
+		if got := m.untilDailySummary(); got != tt.want {
+			t.Errorf("at %s, untilDailySummary() for %s = %s, want %s", tt.now, tt.at, got, tt.want)
+		}
+	}
+}
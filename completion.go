@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// runCompletion writes the completion script of shell for the commands and
+// the flags of fs to w.
+func runCompletion(w io.Writer, fs *flag.FlagSet, shell string) error {
+	switch shell {
+	case "bash":
+		writeBashCompletion(w, fs)
+	case "zsh":
+		writeZshCompletion(w, fs)
+	case "fish":
+		writeFishCompletion(w, fs)
+	default:
+		return fmt.Errorf("invalid shell %q: must be bash, zsh or fish", shell)
+	}
+	return nil
+}
+
+// flagName returns the flag as typed on the command line, e.g. -l or --low.
+func flagName(f *flag.Flag) string {
+	if len(f.Name) == 1 {
+		return "-" + f.Name
+	}
+	return "--" + f.Name
+}
+
+// takesValue reports whether f expects a value, which boolean flags do not.
+func takesValue(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+func writeBashCompletion(w io.Writer, fs *flag.FlagSet) {
+	var words []string
+	for _, command := range commands {
+		words = append(words, command.name)
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		words = append(words, flagName(f))
+	})
+
+	fmt.Fprintf(w, `_battery_notify() {
+	local cur=${COMP_WORDS[COMP_CWORD]}
+	COMPREPLY=($(compgen -W "%s" -- "$cur"))
+}
+complete -F _battery_notify %s
+`, strings.Join(words, " "), appName)
+}
+
+func writeZshCompletion(w io.Writer, fs *flag.FlagSet) {
+	// Brackets delimit the descriptions of _arguments specs, and colons
+	// their other parts.
+	escape := strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`).Replace
+	escapeColons := strings.NewReplacer("'", `'\''`, ":", `\:`).Replace
+
+	fmt.Fprintf(w, "#compdef %s\n\n_arguments \\\n", appName)
+	fs.VisitAll(func(f *flag.Flag) {
+		typ, help := flag.UnquoteUsage(f)
+		spec := fmt.Sprintf("%s[%s]", flagName(f), escape(help))
+		if takesValue(f) {
+			spec += ":" + escapeColons(typ) + ":"
+		}
+		fmt.Fprintf(w, "\t'%s' \\\n", spec)
+	})
+
+	var names []string
+	for _, command := range commands {
+		names = append(names, fmt.Sprintf(`%s\:"%s"`, command.name, escapeColons(command.help)))
+	}
+	fmt.Fprintf(w, "\t'1:command:((%s))'\n", strings.Join(names, " "))
+}
+
+func writeFishCompletion(w io.Writer, fs *flag.FlagSet) {
+	escape := strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace
+
+	for _, command := range commands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -f -a %s -d '%s'\n", appName, command.name, escape(command.help))
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		option := "-l " + f.Name
+		if len(f.Name) == 1 {
+			option = "-s " + f.Name
+		}
+		if takesValue(f) {
+			option += " -r"
+		}
+		_, help := flag.UnquoteUsage(f)
+		fmt.Fprintf(w, "complete -c %s %s -d '%s'\n", appName, option, escape(help))
+	})
+}
@@ -0,0 +1,800 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/godbus/dbus/v5"
+)
+
+// config holds the user-facing settings of battery-notify.
+type config struct {
+	device            string
+	displayDevice     bool
+	signalBuffer      int
+	source            string
+	sysfsPoll         time.Duration
+	reconnectMax      time.Duration
+	singleInstance    bool
+	allowRoot         bool
+	configFile        string
+	model             string
+	sessionBuses      string
+	backend           string
+	thresholdLow      float64
+	thresholdCritical float64
+	lowTime           time.Duration
+	criticalTimeLeft  time.Duration
+	desktopThresholds bool
+	useWarningLevel   bool
+	criticalTime      time.Duration
+	profileLow        profileLevels
+	profileCritical   profileLevels
+	confirmReadings   int
+	trigger           string
+	repeatEvery       time.Duration
+	hysteresis        float64
+	rateWindow        int
+	drainDrop         float64
+	notifyEvery       float64
+	drainWindow       time.Duration
+	suppressOnAC      bool
+	fullEnergy        float64
+	chargeThreshold   int
+	chargeLimit       float64
+	limitRepeat       time.Duration
+	showTimeToFull    bool
+	showChargeRate    bool
+	calibrateOffset   float64
+	calibrateScale    float64
+	synchronousTag    string
+	category          string
+	criticalResident  bool
+	markup            bool
+	maxSummaryLength  int
+	maxBodyLength     int
+	percentPrecision  int
+	percentInSummary  bool
+	valueHintScale    string
+	noValueHint       bool
+	daemonProfile     string
+	sounds            eventStrings
+	urgencies         eventStrings
+	hints             hintValues
+	notifyRemoved     bool
+	notifyFull        bool
+	notifyCharger     bool
+	notifyOnResume    bool
+	suppressLocked    bool
+	closeStates       stateSet
+	consolidate       bool
+	notifyPolicy      string
+	useThemeIcons     bool
+	appIcon           string
+	historyFile       string
+	dailySummaryAt    string
+	urgencyHintKey    string
+	urgencyHintOnly   bool
+	fifo              string
+	journalEvents     bool
+	logDelta          float64
+	color             string
+	durationFormat    string
+	stateNames        stateNames
+	dumpCapabilities  bool
+	follow            bool
+	panicThreshold    float64
+	panicExec         string
+	hooks             hookList
+	beepCritical      bool
+	inhibitIdle       bool
+	beepInterval      time.Duration
+	simulateTick      time.Duration
+
+	// msgs are the strings for the locale, set from the messages files
+	// rather than from flags.
+	msgs messages
+
+	// capabilities are those of the notification server, nil until read.
+	capabilities map[string]bool
+
+	urgencyLowBelow      float64
+	urgencyNormalBelow   float64
+	urgencyCriticalBelow float64
+}
+
+// registerFlags binds the fields of c to command-line flags in fs.
+func (c *config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.device, "device", "auto", "UPower devices to monitor, by name or object path, separated by commas. The default, auto, finds the laptop battery, and all every laptop battery.")
+	fs.BoolVar(&c.displayDevice, "display-device", false, "Monitor the combined level UPower computes for all batteries, its DisplayDevice, instead of --device. Needs --source upower and no --charge-threshold-set.")
+	fs.BoolVar(&c.singleInstance, "single-instance", true, "Exit when another instance is already running for the user.")
+	fs.BoolVar(&c.allowRoot, "allow-root", false, "Run as root, e.g. for hooks on a headless machine or --charge-threshold-set.")
+	fs.StringVar(&c.configFile, "config", "", "Config file read instead of the system-wide and user ones.")
+	fs.DurationVar(&c.reconnectMax, "reconnect-max", 30*time.Second, "Longest wait between attempts to reconnect to the system bus.")
+	fs.StringVar(&c.model, "model", "", "Name shown for devices reporting no model. Defaults to the device name, e.g. BAT0.")
+	fs.StringVar(&c.sessionBuses, "session-bus", "", "D-Bus addresses of the session buses to notify, separated by commas, e.g. one per seat. Defaults to the session bus of the user.")
+	fs.StringVar(&c.backend, "backend", "direct", "How to send notifications: direct to the notification server, or portal through the desktop portal, e.g. in a Flatpak, with plain text bodies.")
+	fs.StringVar(&c.source, "source", "upower", "Where to read the battery level from: upower, sysfs for the raw value of the kernel, sysfs-only to not use UPower at all, or acpi to also not rely on uevents.")
+	fs.DurationVar(&c.sysfsPoll, "sysfs-poll", time.Minute, "Time between readings of the batteries with --source sysfs-only or acpi.")
+	fs.IntVar(&c.signalBuffer, "signal-buffer", 10, "Number of D-Bus signals queued before dropping and resyncing.")
+	c.thresholdLow, c.thresholdCritical = 30, 15
+	low := &threshold{level: &c.thresholdLow, time: &c.lowTime}
+	critical := &threshold{level: &c.thresholdCritical, time: &c.criticalTimeLeft}
+	fs.Var(low, "l", "Threshold for low battery level, as a `LEVEL` or a time to empty such as 20m.")
+	fs.Var(low, "low", "Threshold for low battery level, as a `LEVEL` or a time to empty such as 20m.")
+	fs.Var(critical, "c", "Threshold for critical battery level, as a `LEVEL` or a time to empty such as 10m.")
+	fs.Var(critical, "critical", "Threshold for critical battery level, as a `LEVEL` or a time to empty such as 10m.")
+	fs.Var(&c.profileLow, "profile-low", "Low threshold for a power profile as `PROFILE=LEVEL`, e.g. power-saver=40. Repeatable.")
+	fs.Var(&c.profileCritical, "profile-critical", "Critical threshold for a power profile as `PROFILE=LEVEL`. Repeatable.")
+	fs.BoolVar(&c.useWarningLevel, "use-warning-level", false, "Notify at the low and critical warning levels of UPower, set in UPower.conf, instead of --low and --critical.")
+	fs.BoolVar(&c.desktopThresholds, "desktop-thresholds", false, "Use the low and critical levels of the power settings of the desktop when available.")
+	fs.DurationVar(&c.criticalTime, "critical-time", 0, "Time to empty below which the battery level is critical, e.g. 5m.")
+	fs.IntVar(&c.chargeThreshold, "charge-threshold-set", 0, "Make the firmware stop charging the battery at this level, on laptops supporting it. Needs root.")
+	fs.Float64Var(&c.chargeLimit, "charge-limit", 0, "Warn while charging at or above this level, to unplug the charger. Zero disables it.")
+	fs.DurationVar(&c.limitRepeat, "charge-limit-repeat", 5*time.Minute, "Interval at which the --charge-limit warning is repeated, as critical, until unplugged. Zero warns once.")
+	fs.BoolVar(&c.showTimeToFull, "show-time-to-full", false, "Show the time until full from UPower in the --charge-limit warning.")
+	fs.BoolVar(&c.showChargeRate, "show-charge-rate", false, "Show the charging power in the --charge-limit warning.")
+	fs.IntVar(&c.rateWindow, "rate-window", 0, "Number of discharge rate readings averaged to estimate the time left. Zero uses the estimate of UPower.")
+	fs.Float64Var(&c.notifyEvery, "notify-every", 0, "Send a low urgency notification every time the level drops by another `N` points while discharging. Zero disables it.")
+	fs.Float64Var(&c.drainDrop, "drain-drop", 0, "Warn when the level drops by this many points within --drain-window, even above the low threshold. Zero disables it.")
+	fs.DurationVar(&c.drainWindow, "drain-window", 5*time.Minute, "Time over which --drain-drop is measured.")
+	fs.StringVar(&c.trigger, "trigger", "edge", "When to notify below a threshold: edge to only notify on crossing a threshold, or level to update the notification on every new level.")
+	fs.DurationVar(&c.repeatEvery, "repeat-every", 0, "With --trigger edge, interval at which the notification is sent again while below the same threshold. Zero never repeats it.")
+	fs.Float64Var(&c.hysteresis, "hysteresis", 0, "Points above a threshold the level must rise to before a notified battery counts as above it again.")
+	fs.IntVar(&c.confirmReadings, "confirm-readings", 1, "Consecutive low readings required before notifying.")
+	fs.BoolVar(&c.suppressOnAC, "suppress-on-ac", false, "Skip notifications while a line power device is online, whatever the battery state.")
+	fs.Float64Var(&c.fullEnergy, "battery-full-design", 0, "Full energy of the battery in Wh, overriding the percentage reported by UPower.")
+	fs.Float64Var(&c.calibrateOffset, "calibrate-offset", 0, "Offset added to the battery level after scaling.")
+	fs.Float64Var(&c.calibrateScale, "calibrate-scale", 1, "Factor the battery level is multiplied by.")
+	fs.Float64Var(&c.urgencyLowBelow, "urgency-low-below", -1, "Level at or below which notifications have low urgency. Negative follows --low.")
+	fs.Float64Var(&c.urgencyNormalBelow, "urgency-normal-below", -1, "Level at or below which notifications have normal urgency. Negative disables it.")
+	fs.Float64Var(&c.urgencyCriticalBelow, "urgency-critical-below", -1, "Level at or below which notifications have critical urgency. Negative follows --critical.")
+	fs.BoolVar(&c.useThemeIcons, "use-theme-icons", false, "Set an icon from the icon theme matching the battery level.")
+	fs.StringVar(&c.appIcon, "app-icon", "", "Icon of every notification, as an `ICON` name from the icon theme or an absolute path. --use-theme-icons takes precedence.")
+	fs.StringVar(&c.synchronousTag, "synchronous", "", "Tag for the x-canonical-private-synchronous hint.")
+	fs.StringVar(&c.category, "category", "device.battery", "Category hint of every notification, for the rules of notification servers. Empty leaves it out.")
+	fs.BoolVar(&c.markup, "markup", false, "Highlight the battery level with body markup when the notification server supports it.")
+	fs.IntVar(&c.maxSummaryLength, "max-summary-length", 0, "Longest summary in characters, truncated with an ellipsis. Zero means no limit.")
+	fs.IntVar(&c.maxBodyLength, "max-body-length", 0, "Longest body in characters, truncated with an ellipsis. Zero means no limit.")
+	fs.BoolVar(&c.criticalResident, "critical-resident", false, "Keep critical notifications in place until closed, on daemons honoring the resident hint.")
+	fs.StringVar(&c.notifyPolicy, "notification-policy", "replace", "Whether each event replaces the last notification, replace, or has its own, per-event.")
+	fs.BoolVar(&c.consolidate, "consolidate", false, "Send a single notification listing every low device.")
+	fs.BoolVar(&c.percentInSummary, "percent-in-summary", false, "Also show the battery level in the summary, for notification servers collapsing the body.")
+	fs.IntVar(&c.percentPrecision, "percentage-precision", 0, "Number of decimals of the battery level shown, from 0 to 2. The value hint stays an integer.")
+	fs.StringVar(&c.valueHintScale, "value-hint-scale", "0-100", "Range of the value hint, either 0-100 or 0-1.")
+	fs.BoolVar(&c.noValueHint, "no-value-hint", false, "Leave out the value hint, for daemons rendering it badly.")
+	fs.StringVar(&c.daemonProfile, "daemon-profile", "generic", "Adjust the hints to the notification daemon: generic, gnome or kde.")
+	fs.Var(&c.hints, "hint", "Extra hint added to every notification as `NAME=TYPE:VALUE`, where TYPE is string, int or bool, e.g. suppress-sound=bool:true. Repeatable.")
+	fs.Var(&c.urgencies, "urgency", "Urgency of the notifications of an event as `EVENT=URGENCY`, e.g. low=critical, overriding the urgency bands. Repeatable.")
+	fs.Var(&c.sounds, "sound", "Sound name for an event as `EVENT=NAME`, e.g. critical=battery-caution. Repeatable.")
+	fs.BoolVar(&c.notifyRemoved, "notify-removed", false, "Send a notification when the battery is removed.")
+	fs.BoolVar(&c.notifyFull, "notify-full", false, "Send a notification when the battery finishes charging.")
+	fs.BoolVar(&c.suppressLocked, "suppress-when-locked", false, "Hold back notifications other than critical ones while the screen is locked, until it is unlocked.")
+	fs.BoolVar(&c.notifyOnResume, "notify-on-resume", false, "Check the battery level again right after resuming from suspend.")
+	c.closeStates = stateSet{stateCharging: true, stateFullyCharged: true, statePendingCharge: true}
+	fs.Var(&c.closeStates, "close-states", "Comma-separated `STATES` closing the warning once the battery enters them, e.g. charging,fully-charged.")
+	fs.BoolVar(&c.notifyCharger, "notify-charger", false, "Send a notification when the battery discharges while on AC, e.g. with an underpowered charger.")
+	fs.StringVar(&c.urgencyHintKey, "urgency-hint-key", "", "Also set the urgency in the hint named `KEY`, for notification servers not reading the standard urgency hint.")
+	fs.BoolVar(&c.urgencyHintOnly, "urgency-hint-only", false, "Set the urgency in the hint named by --urgency-hint-key instead of the standard urgency hint.")
+	fs.StringVar(&c.dailySummaryAt, "daily-summary-at", "", "Send a summary of the level and health of the batteries every day at this `HH:MM` time.")
+	fs.StringVar(&c.historyFile, "history-file", "", "Append a JSON line to this file for every notification sent.")
+	fs.StringVar(&c.fifo, "fifo", "", "Write the status line of a device to this named pipe, created if needed, on every change. Meant for status bars.")
+	fs.DurationVar(&c.simulateTick, "simulate-tick", time.Second, "Time between readings of the simulate command.")
+	fs.Var(&c.stateNames, "state-name", "Display name of a UPower state as `STATE=NAME`, e.g. 4=Full for Fully Charged. Repeatable.")
+	fs.StringVar(&c.durationFormat, "duration-format", "short", "Style of the time left: short (1h23m), clock (1:23) or minutes (83 min).")
+	fs.BoolVar(&c.follow, "follow", false, "Print a line for every change of the devices instead of sending notifications.")
+	fs.BoolVar(&c.dumpCapabilities, "dump-capabilities", false, "Print the capabilities of the notification server and exit.")
+	fs.Float64Var(&c.logDelta, "min-percentage-delta-for-log", 5, "Change of the battery level needed to log another skipped notification at info level. Zero logs every one.")
+	fs.BoolVar(&c.journalEvents, "journal-events", false, "Record every event as a structured entry in the systemd journal.")
+	fs.StringVar(&c.color, "color", "auto", "Color the output of the status command: auto, always or never.")
+	fs.Float64Var(&c.panicThreshold, "panic-threshold", 5, "Level at or below which --panic-exec runs. Must not exceed --low.")
+	fs.StringVar(&c.panicExec, "panic-exec", "", "Shell command run once per discharge cycle at the panic threshold.")
+	fs.BoolVar(&c.beepCritical, "beep-critical", false, "Beep the PC speaker of the Linux console while the level is critical. Needs root.")
+	fs.DurationVar(&c.beepInterval, "beep-interval", 30*time.Second, "Time between beeps with --beep-critical.")
+	fs.BoolVar(&c.inhibitIdle, "inhibit-idle", false, "Keep the screen from blanking while the level is critical, so that the warning is seen.")
+	fs.Var(&c.hooks, "hook", "Shell command run on an event as `EVENT[:WHEN]=COMMAND`, where WHEN is charging, discharging or any. Repeatable.")
+}
+
+// calibrate applies the linear calibration set by the user to a battery level,
+// clamping the result to 0-100. Some batteries report up to 105% right after
+// a full charge, so the level is clamped even without calibration.
+func (c *config) calibrate(percentage float64) float64 {
+	return min(max(percentage*c.calibrateScale+c.calibrateOffset, 0), 100)
+}
+
+// eventStrings is a flag holding a string per event, set as "event=string".
+type eventStrings map[event]string
+
+func (m *eventStrings) String() string {
+	if m == nil {
+		return ""
+	}
+	var pairs []string
+	for ev, value := range *m {
+		pairs = append(pairs, ev.String()+"="+value)
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *eventStrings) Set(value string) error {
+	name, value, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected EVENT=VALUE, got %q", name)
+	}
+	ev, err := parseEvent(name)
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = eventStrings{}
+	}
+	(*m)[ev] = value
+	return nil
+}
+
+// stateNames is a flag holding display names of UPower states, set as
+// "state=name" where state is the number of a known state, e.g. 4=Full.
+type stateNames map[uint32]string
+
+func (m *stateNames) String() string {
+	if m == nil {
+		return ""
+	}
+	var pairs []string
+	for state, name := range *m {
+		pairs = append(pairs, fmt.Sprintf("%d=%s", state, name))
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *stateNames) Set(value string) error {
+	number, name, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected STATE=NAME, got %q", number)
+	}
+	state, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid state %q: %w", number, err)
+	}
+	if _, ok := stateMap[uint32(state)]; !ok {
+		return fmt.Errorf("unknown state %d: must be between 0 and %d", state, len(stateMap)-1)
+	}
+	if *m == nil {
+		*m = stateNames{}
+	}
+	(*m)[uint32(state)] = name
+	return nil
+}
+
+// stateSet is a flag holding a comma-separated list of UPower states, named
+// as in --state-name keys but in lower case, e.g. fully-charged.
+type stateSet map[uint32]bool
+
+func (s *stateSet) String() string {
+	if s == nil {
+		return ""
+	}
+	var names []string
+	for state := range *s {
+		names = append(names, stateFlagName(state))
+	}
+	slices.Sort(names)
+	return strings.Join(names, ",")
+}
+
+func (s *stateSet) Set(value string) error {
+	set := stateSet{}
+	for _, name := range strings.Split(value, ",") {
+		state, ok := parseStateName(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown state %q", name)
+		}
+		set[state] = true
+	}
+	*s = set
+	return nil
+}
+
+// stateFlagName returns the name of state in flags, e.g. pending-charge.
+func stateFlagName(state uint32) string {
+	return strings.TrimPrefix(messageKey("state", stateMap[state]), "state-")
+}
+
+// parseStateName returns the state named name in flags.
+func parseStateName(name string) (uint32, bool) {
+	for state := range stateMap {
+		if stateFlagName(state) == name {
+			return state, true
+		}
+	}
+	return 0, false
+}
+
+// threshold is a flag holding either a battery level or a time to empty, such
+// as 15 or 10m. Setting one unit turns the other off, so that --critical 10m
+// does not also fire at the default level.
+type threshold struct {
+	level *float64
+	time  *time.Duration
+}
+
+func (t *threshold) String() string {
+	if t == nil || t.level == nil {
+		return ""
+	}
+	if *t.time > 0 {
+		return t.time.String()
+	}
+	return strconv.FormatFloat(*t.level, 'g', -1, 64)
+}
+
+func (t *threshold) Set(value string) error {
+	if level, err := strconv.ParseFloat(value, 64); err == nil {
+		*t.level, *t.time = level, 0
+		return nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("expected a level or a duration, got %q", value)
+	}
+	*t.level, *t.time = 0, d
+	return nil
+}
+
+// hintValues is a flag holding extra notification hints, set as
+// "name=type:value" where type is string, int or bool.
+type hintValues map[string]dbus.Variant
+
+func (m *hintValues) String() string {
+	if m == nil {
+		return ""
+	}
+	var pairs []string
+	for name, value := range *m {
+		pairs = append(pairs, name+"="+value.String())
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *hintValues) Set(value string) error {
+	name, value, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected NAME=TYPE:VALUE, got %q", name)
+	}
+	hint, err := parseHint(value)
+	if err != nil {
+		return fmt.Errorf("invalid hint %s: %w", name, err)
+	}
+	m.add(name, hint)
+	return nil
+}
+
+// setNative sets the hint name to v, a string, integer or boolean of the
+// config file, which needs no type.
+func (m *hintValues) setNative(name string, v any) error {
+	switch v := v.(type) {
+	case string, bool:
+		m.add(name, dbus.MakeVariant(v))
+	case int64:
+		if v < math.MinInt32 || v > math.MaxInt32 {
+			return fmt.Errorf("invalid hint %s: %d is out of range", name, v)
+		}
+		m.add(name, dbus.MakeVariant(int32(v)))
+	default:
+		return fmt.Errorf("invalid hint %s: must be a string, integer or boolean", name)
+	}
+	return nil
+}
+
+func (m *hintValues) add(name string, hint dbus.Variant) {
+	if *m == nil {
+		*m = hintValues{}
+	}
+	(*m)[name] = hint
+}
+
+// parseHint returns the variant of a hint value given as "type:value".
+func parseHint(value string) (dbus.Variant, error) {
+	kind, value, ok := strings.Cut(value, ":")
+	if !ok {
+		return dbus.Variant{}, fmt.Errorf("expected TYPE:VALUE, got %q", kind)
+	}
+
+	switch kind {
+	case "string":
+		return dbus.MakeVariant(value), nil
+	case "int":
+		n, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return dbus.Variant{}, err
+		}
+		return dbus.MakeVariant(int32(n)), nil
+	case "bool":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return dbus.Variant{}, err
+		}
+		return dbus.MakeVariant(b), nil
+	default:
+		return dbus.Variant{}, fmt.Errorf("unknown type %q: must be string, int or bool", kind)
+	}
+}
+
+// withoutUPower reports whether the batteries are read without UPower.
+func (c *config) withoutUPower() bool {
+	return c.source == "sysfs-only" || c.source == "acpi"
+}
+
+// devicePaths returns the object paths of the monitored UPower devices.
+func (c *config) devicePaths() []dbus.ObjectPath {
+	var paths []dbus.ObjectPath
+	for _, name := range strings.Split(c.device, ",") {
+		name = strings.TrimSpace(name)
+		if !strings.HasPrefix(name, "/") {
+			name = devicesPath + name
+		}
+		paths = append(paths, dbus.ObjectPath(name))
+	}
+	return paths
+}
+
+// modelName returns the name shown for the device at path reporting model,
+// falling back to --model or the device name, e.g. BAT0, for empty models.
+// With several devices monitored, the device name follows the model, as two
+// batteries of a laptop often report the same one.
+func (c *config) modelName(path dbus.ObjectPath, model string) string {
+	name := strings.TrimPrefix(filepath.Base(string(path)), "battery_")
+	if model == "" {
+		model = c.model
+	}
+	switch {
+	case model == "" && name == displayDeviceName:
+		return c.msgs.allBatteries
+	case model == "":
+		return name
+	case len(c.devicePaths()) > 1:
+		return fmt.Sprintf("%s (%s)", model, name)
+	default:
+		return model
+	}
+}
+
+// validate reports settings that are out of range.
+func (c *config) validate() error {
+	for _, path := range c.devicePaths() {
+		if !path.IsValid() {
+			return fmt.Errorf("invalid device %q", path)
+		}
+	}
+
+	if c.configFile != "" {
+		if _, err := os.Stat(c.configFile); err != nil {
+			return fmt.Errorf("invalid config file: %w", err)
+		}
+	}
+
+	if c.signalBuffer < 1 {
+		return fmt.Errorf("invalid signal buffer %d: must be at least 1", c.signalBuffer)
+	}
+
+	if c.maxSummaryLength < 0 || c.maxBodyLength < 0 {
+		return errors.New("invalid maximum length: must not be negative")
+	}
+
+	if c.logDelta < 0 {
+		return fmt.Errorf("invalid log delta %g: must not be negative", c.logDelta)
+	}
+
+	// The panic hook is a last resort below the low level, which is only
+	// known when --low is a level rather than a time.
+	if c.panicExec != "" && c.lowTime == 0 && c.panicThreshold > c.thresholdLow {
+		return fmt.Errorf("invalid panic threshold %g: must not exceed the low threshold %g", c.panicThreshold, c.thresholdLow)
+	}
+
+	if c.chargeThreshold < 0 || c.chargeThreshold > 100 {
+		return fmt.Errorf("invalid charge threshold %d: must be between 0 and 100", c.chargeThreshold)
+	}
+
+	if c.dailySummaryAt != "" {
+		if _, err := time.Parse("15:04", c.dailySummaryAt); err != nil {
+			return fmt.Errorf("invalid daily summary time %q: must be HH:MM", c.dailySummaryAt)
+		}
+	}
+
+	if c.appIcon != "" && strings.ContainsRune(c.appIcon, '/') {
+		if !filepath.IsAbs(c.appIcon) {
+			return fmt.Errorf("invalid app icon %q: must be an icon name or an absolute path", c.appIcon)
+		}
+		if _, err := os.Stat(c.appIcon); err != nil {
+			return fmt.Errorf("invalid app icon: %w", err)
+		}
+	}
+
+	if c.percentPrecision < 0 || c.percentPrecision > 2 {
+		return fmt.Errorf("invalid percentage precision %d: must be between 0 and 2", c.percentPrecision)
+	}
+
+	if c.chargeLimit < 0 || c.chargeLimit > 100 {
+		return fmt.Errorf("invalid charge limit %g: must be between 0 and 100", c.chargeLimit)
+	}
+	if c.limitRepeat < 0 {
+		return fmt.Errorf("invalid charge limit repeat %s: must not be negative", c.limitRepeat)
+	}
+
+	switch c.trigger {
+	case "level", "edge":
+	default:
+		return fmt.Errorf("invalid trigger %q: must be level or edge", c.trigger)
+	}
+	if c.repeatEvery < 0 || c.hysteresis < 0 {
+		return fmt.Errorf("invalid repeat %s or hysteresis %g: must not be negative", c.repeatEvery, c.hysteresis)
+	}
+
+	if c.notifyEvery < 0 || c.notifyEvery > 100 {
+		return fmt.Errorf("invalid notify every %g: must be between 0 and 100", c.notifyEvery)
+	}
+
+	if c.drainDrop < 0 || c.drainWindow <= 0 {
+		return fmt.Errorf("invalid drain drop %g over %s: must not be negative over a positive window", c.drainDrop, c.drainWindow)
+	}
+
+	if c.rateWindow < 0 {
+		return fmt.Errorf("invalid rate window %d: must not be negative", c.rateWindow)
+	}
+
+	if c.reconnectMax < time.Second {
+		return fmt.Errorf("invalid reconnect max %s: must be at least 1s", c.reconnectMax)
+	}
+
+	if c.beepInterval <= 0 {
+		return fmt.Errorf("invalid beep interval %s: must be positive", c.beepInterval)
+	}
+
+	if c.simulateTick <= 0 {
+		return fmt.Errorf("invalid simulate tick %s: must be positive", c.simulateTick)
+	}
+
+	switch c.durationFormat {
+	case "short", "clock", "minutes":
+	default:
+		return fmt.Errorf("invalid duration format %q: must be short, clock or minutes", c.durationFormat)
+	}
+
+	switch c.color {
+	case "auto", "always", "never":
+	default:
+		return fmt.Errorf("invalid color %q: must be auto, always or never", c.color)
+	}
+
+	// DisplayDevice has no NativePath, which sysfs and the charge threshold
+	// are reached by.
+	if c.displayDevice && c.source == "sysfs" {
+		return errors.New("--display-device cannot be used with --source sysfs")
+	}
+	if c.displayDevice && c.chargeThreshold > 0 {
+		return errors.New("--display-device cannot be used with --charge-threshold-set")
+	}
+
+	if c.urgencyHintOnly && c.urgencyHintKey == "" {
+		return errors.New("--urgency-hint-only cannot be used without --urgency-hint-key")
+	}
+
+	switch c.source {
+	case "upower", "sysfs":
+	case "sysfs-only", "acpi":
+		if c.sysfsPoll <= 0 {
+			return fmt.Errorf("invalid sysfs poll %s: must be positive", c.sysfsPoll)
+		}
+		// These need UPower or logind on the system bus.
+		for name, set := range map[string]bool{
+			"suppress-on-ac":       c.suppressOnAC,
+			"notify-charger":       c.notifyCharger,
+			"notify-on-resume":     c.notifyOnResume,
+			"inhibit-idle":         c.inhibitIdle,
+			"daily-summary-at":     c.dailySummaryAt != "",
+			"use-warning-level":    c.useWarningLevel,
+			"suppress-when-locked": c.suppressLocked,
+			"display-device":       c.displayDevice,
+			"profile-low":          len(c.profileLow) > 0,
+			"profile-critical":     len(c.profileCritical) > 0,
+		} {
+			if set {
+				return fmt.Errorf("--%s cannot be used with --source %s", name, c.source)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid source %q: must be upower, sysfs, sysfs-only or acpi", c.source)
+	}
+
+	for ev, name := range c.urgencies {
+		if _, ok := urgencies[name]; !ok {
+			return fmt.Errorf("invalid urgency %q for %s: must be low, normal or critical", name, ev)
+		}
+	}
+
+	switch c.backend {
+	case "direct", "portal":
+	default:
+		return fmt.Errorf("invalid backend %q: must be direct or portal", c.backend)
+	}
+
+	switch c.notifyPolicy {
+	case "replace", "per-event":
+	default:
+		return fmt.Errorf("invalid notification policy %q: must be replace or per-event", c.notifyPolicy)
+	}
+
+	switch c.daemonProfile {
+	case "generic", "gnome", "kde":
+	default:
+		return fmt.Errorf("invalid daemon profile %q: must be generic, gnome or kde", c.daemonProfile)
+	}
+
+	switch c.valueHintScale {
+	case "0-100", "0-1":
+	default:
+		return fmt.Errorf("invalid value hint scale %q: must be 0-100 or 0-1", c.valueHintScale)
+	}
+	return nil
+}
+
+// configDirs returns the directories holding config files, from lowest to
+// highest precedence.
+func configDirs() []string {
+	dirs := []string{filepath.Join("/etc", appName)}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, appName))
+	}
+	return dirs
+}
+
+// configPaths returns the config files read at startup, from lowest to highest
+// precedence, or only the file given by --config in args.
+func configPaths(args []string) []string {
+	if path, ok := configFlag(args); ok {
+		return []string{path}
+	}
+
+	var paths []string
+	for _, dir := range configDirs() {
+		paths = append(paths, filepath.Join(dir, "config.toml"))
+	}
+	return paths
+}
+
+// configFlag returns the value of --config in args. It is looked up before the
+// command line is parsed, since the config files are read first.
+func configFlag(args []string) (string, bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name, value, ok := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if name != "config" {
+			continue
+		}
+		if ok {
+			return value, true
+		}
+		if i+1 < len(args) {
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// loadConfigFiles applies the settings in each of paths to the flags of flags.
+// Later files override earlier ones and missing files are skipped. It must be
+// called before parsing the command line so that flags take precedence.
+func loadConfigFiles(flags *flag.FlagSet, paths []string) error {
+	for _, path := range paths {
+		if err := loadConfigFile(flags, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConfigFile applies the settings in the TOML file at path to flags. Each
+// key is the long name of a flag, set once for each element of an array.
+// Settings in a table are passed to the repeatable flag named after the table
+// as "key=value" instead, except for hints, whose values keep their TOML type.
+func loadConfigFile(flags *flag.FlagSet, path string) error {
+	var settings map[string]any
+	meta, err := toml.DecodeFile(path, &settings)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Keys are walked in the order of the file, so that repeatable flags
+	// keep it.
+	for _, key := range meta.Keys() {
+		var name, prefix string
+		var value any
+		switch len(key) {
+		case 1:
+			if _, ok := settings[key[0]].(map[string]any); ok {
+				continue
+			}
+			name, value = key[0], settings[key[0]]
+		case 2:
+			table, ok := settings[key[0]].(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: %s: expected a table", path, key)
+			}
+			name, prefix, value = key[0], key[1]+"=", table[key[1]]
+			if f := flags.Lookup(name); f != nil {
+				if hints, ok := f.Value.(*hintValues); ok {
+					if err := hints.setNative(key[1], value); err != nil {
+						return fmt.Errorf("%s: %s: %w", path, key, err)
+					}
+					continue
+				}
+			}
+		default:
+			return fmt.Errorf("%s: %s: tables cannot be nested", path, key)
+		}
+
+		values, err := configValues(value)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", path, key, err)
+		}
+		for _, v := range values {
+			if err := flags.Set(name, prefix+v); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// configValues returns the flag values of the TOML value v, one for a string,
+// number or boolean and one for each element of an array of those.
+func configValues(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, nil
+	case int64:
+		return []string{strconv.FormatInt(v, 10)}, nil
+	case float64:
+		return []string{strconv.FormatFloat(v, 'f', -1, 64)}, nil
+	case bool:
+		return []string{strconv.FormatBool(v)}, nil
+	case []any:
+		var values []string
+		for _, element := range v {
+			if _, ok := element.([]any); ok {
+				return nil, errors.New("arrays cannot be nested")
+			}
+			elementValues, err := configValues(element)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, elementValues...)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("unsupported value %v", v)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// newConfigFlags returns a config with its flags registered on a new flag set.
+func newConfigFlags() (*config, *flag.FlagSet) {
+	var cfg config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	return &cfg, fs
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := `# Thresholds
+low = 25
+critical = '10m'
+consolidate = true
+min-percentage-delta-for-log = 2.5
+
+[hook]
+"low:discharging" = "brightnessctl set 30%"
+critical = 'notify-send "Plug in"'
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, fs := newConfigFlags()
+	if err := loadConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.thresholdLow != 25 {
+		t.Errorf("low = %g, want 25", cfg.thresholdLow)
+	}
+	if cfg.criticalTimeLeft.String() != "10m0s" {
+		t.Errorf("critical time = %s, want 10m0s", cfg.criticalTimeLeft)
+	}
+	if !cfg.consolidate {
+		t.Error("consolidate = false, want true")
+	}
+	if cfg.logDelta != 2.5 {
+		t.Errorf("log delta = %g, want 2.5", cfg.logDelta)
+	}
+
+	want := hookList{
+		{ev: eventLow, when: "discharging", command: "brightnessctl set 30%"},
+		{ev: eventCritical, when: "any", command: `notify-send "Plug in"`},
+	}
+	if !slices.Equal(cfg.hooks, want) {
+		t.Errorf("hooks = %v, want %v", cfg.hooks, want)
+	}
+}
+
+func TestLoadConfigFileHints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	data := `[hint]
+suppress-sound = true
+x-priority = 5
+image-path = "battery-low"
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, fs := newConfigFlags()
+	if err := loadConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]any{
+		"suppress-sound": true,
+		"x-priority":     int32(5),
+		"image-path":     "battery-low",
+	}
+	if len(cfg.hints) != len(want) {
+		t.Errorf("hints = %v, want %v", cfg.hints, want)
+	}
+	for name, value := range want {
+		if got := cfg.hints[name].Value(); got != value {
+			t.Errorf("hint %s = %v (%T), want %v (%T)", name, got, got, value, value)
+		}
+	}
+}
+
+func TestLoadConfigFileHintsInvalid(t *testing.T) {
+	for _, value := range []string{"1.5", "[true]", "4294967296"} {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(path, []byte("[hint]\nx-value = "+value+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, fs := newConfigFlags()
+		if err := loadConfigFile(fs, path); err == nil {
+			t.Errorf("loading the hint %s succeeded, want an error", value)
+		}
+	}
+}
+
+func TestLoadConfigFileArray(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(`hook = ["low=echo low", "critical=echo critical"]`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, fs := newConfigFlags()
+	if err := loadConfigFile(fs, path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := hookList{
+		{ev: eventLow, when: "any", command: "echo low"},
+		{ev: eventCritical, when: "any", command: "echo critical"},
+	}
+	if !slices.Equal(cfg.hooks, want) {
+		t.Errorf("hooks = %v, want %v", cfg.hooks, want)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	for name, data := range map[string]string{
+		"invalid TOML":   "low = ",
+		"unknown flag":   "lowest = 10",
+		"invalid value":  `low = "abc"`,
+		"nested table":   "[hook.low]\ncharging = \"echo\"",
+		"table of value": "[low]\nx = 1",
+	} {
+		path := filepath.Join(t.TempDir(), "config.toml")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := loadConfigFile(configFlags(), path); err == nil {
+			t.Errorf("%s: loading %q succeeded, want an error", name, data)
+		}
+	}
+}
+
+// configFlags returns a new flag set with the flags of a config.
+func configFlags() *flag.FlagSet {
+	_, fs := newConfigFlags()
+	return fs
+}
+
+func TestLoadConfigFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := loadConfigFile(configFlags(), path); err != nil {
+		t.Errorf("loading a missing file: %s, want it skipped", err)
+	}
+}
+
+func TestValidatePanicThreshold(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"--panic-exec", "sync", "--panic-threshold", "5", "--low", "20"}, true},
+		{[]string{"--panic-exec", "sync", "--panic-threshold", "20", "--low", "20"}, true},
+		{[]string{"--panic-exec", "sync", "--panic-threshold", "25", "--low", "20"}, false},
+		{[]string{"--panic-threshold", "25", "--low", "20"}, true},
+		{[]string{"--panic-exec", "sync", "--panic-threshold", "25", "--low", "20m"}, true},
+	}
+
+	for _, tt := range tests {
+		cfg, fs := newConfigFlags()
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate() with %q = %v, want ok %t", tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestCriticalTimeLimit(t *testing.T) {
+	tests := []struct {
+		args []string
+		want time.Duration
+	}{
+		{[]string{"--critical", "10m"}, 10 * time.Minute},
+		{[]string{"--critical-time", "5m"}, 5 * time.Minute},
+		{[]string{"--critical", "10m", "--critical-time", "5m"}, 10 * time.Minute},
+		{[]string{"--critical-time", "5m", "--critical", "10m"}, 10 * time.Minute},
+		{[]string{"--critical-time", "10m", "--critical", "3m"}, 10 * time.Minute},
+		// A level does not clear the time, in either order.
+		{[]string{"--critical-time", "10m", "--critical", "15"}, 10 * time.Minute},
+		{[]string{"--critical", "15", "--critical-time", "10m"}, 10 * time.Minute},
+		// Only the last value of the same flag counts.
+		{[]string{"--critical", "10m", "--critical", "15"}, 0},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, tt.args...)
+		if got := cfg.criticalTimeLimit(); got != tt.want {
+			t.Errorf("criticalTimeLimit() with %q = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyCriticalLevelAndTime(t *testing.T) {
+	cfg := newTestConfig(t, "--critical-time", "10m", "--critical", "15")
+	tests := []struct {
+		percentage float64
+		timeLeft   time.Duration
+		want       event
+		ok         bool
+	}{
+		{50, time.Hour, 0, false},
+		{14, time.Hour, eventCritical, true},
+		{50, 5 * time.Minute, eventCritical, true},
+		{25, time.Hour, eventLow, true},
+	}
+
+	for _, tt := range tests {
+		ev, ok := cfg.classify(tt.percentage, tt.timeLeft)
+		if ev != tt.want || ok != tt.ok {
+			t.Errorf("classify(%g, %s) = %s, %t, want %s, %t", tt.percentage, tt.timeLeft, ev, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestModelName(t *testing.T) {
+	bat1 := dbus.ObjectPath(devicesPath + "battery_BAT1")
+	display := dbus.ObjectPath(devicesPath + displayDeviceName)
+
+	tests := []struct {
+		args  []string
+		path  dbus.ObjectPath
+		model string
+		want  string
+	}{
+		{nil, testDevice, "5B10W13930", "5B10W13930"},
+		{nil, testDevice, "", "BAT0"},
+		{[]string{"--model", "Laptop"}, testDevice, "", "Laptop"},
+		{[]string{"--model", "Laptop"}, testDevice, "5B10W13930", "5B10W13930"},
+		{[]string{"--device", displayDeviceName}, display, "", "All batteries"},
+		{[]string{"--device", "battery_BAT0,battery_BAT1"}, bat1, "5B10W13930", "5B10W13930 (BAT1)"},
+		{[]string{"--device", "battery_BAT0,battery_BAT1"}, bat1, "", "BAT1"},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, tt.args...)
+		if got := cfg.modelName(tt.path, tt.model); got != tt.want {
+			t.Errorf("modelName(%s, %q) with %q = %q, want %q", tt.path, tt.model, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	tests := []struct {
+		args       []string
+		percentage float64
+		want       float64
+	}{
+		{nil, 50, 50},
+		{nil, 100, 100},
+		// Some batteries report above 100% right after a full charge.
+		{nil, 105, 100},
+		{nil, 100.5, 100},
+		{nil, -1, 0},
+		{[]string{"--calibrate-scale", "1.1"}, 95, 100},
+		{[]string{"--calibrate-scale", "1.1"}, 50, 55},
+		{[]string{"--calibrate-offset", "-5"}, 103, 98},
+		{[]string{"--calibrate-offset", "-5"}, 3, 0},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, tt.args...)
+		if got := cfg.calibrate(tt.percentage); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("calibrate(%g) with %q = %g, want %g", tt.percentage, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDisplayDevice(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"--display-device"}, true},
+		{[]string{"--display-device", "--source", "upower"}, true},
+		{[]string{"--display-device", "--source", "sysfs"}, false},
+		{[]string{"--display-device", "--source", "sysfs-only"}, false},
+		{[]string{"--display-device", "--source", "acpi"}, false},
+		{[]string{"--display-device", "--charge-threshold-set", "80"}, false},
+		{[]string{"--source", "sysfs", "--charge-threshold-set", "80"}, true},
+	}
+
+	for _, tt := range tests {
+		cfg, fs := newConfigFlags()
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate() with %q = %v, want ok %t", tt.args, err, tt.ok)
+		}
+	}
+}
+
+func TestValidateUrgencyHintOnly(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"--urgency-hint-key", "x-urgency"}, true},
+		{[]string{"--urgency-hint-key", "x-urgency", "--urgency-hint-only"}, true},
+		{[]string{"--urgency-hint-only"}, false},
+	}
+
+	for _, tt := range tests {
+		cfg, fs := newConfigFlags()
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.validate(); (err == nil) != tt.ok {
+			t.Errorf("validate() with %q = %v, want ok %t", tt.args, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// nextDailySummary returns the first time after now at the time of day at,
+// given as HH:MM.
+func nextDailySummary(now time.Time, at string) time.Time {
+	clock, _ := time.Parse("15:04", at)
+	next := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// untilDailySummary returns the time left until the next daily summary.
+func (m *monitor) untilDailySummary() time.Duration {
+	now := m.clock.Now()
+	return nextDailySummary(now, m.cfg.dailySummaryAt).Sub(now)
+}
+
+// sendDailySummary sends a notification giving the level and health of each
+// device, and how many times the battery ran low since the last summary.
+func (m *monitor) sendDailySummary(ctx context.Context) {
+	paths := slices.Sorted(maps.Keys(m.devices))
+
+	lowest := 100.0
+	entries := make([]string, 0, len(paths)+1)
+	for _, path := range paths {
+		properties, err := deviceProperties(m.sysConn, path)
+		if err != nil {
+			slog.Error(err.Error())
+			continue
+		}
+
+		model, _ := properties["Model"].Value().(string)
+		percentage, _ := properties["Percentage"].Value().(float64)
+		capacity, _ := properties["Capacity"].Value().(float64)
+
+		percentage = m.cfg.calibrate(percentage)
+		lowest = min(lowest, percentage)
+
+		entry := fmt.Sprintf("%s <b>%s</b>", html.EscapeString(m.cfg.modelName(path, model)), m.cfg.formatPercentage(percentage))
+		if capacity > 0 {
+			entry += ", " + html.EscapeString(fmt.Sprintf(m.cfg.msgs.health, capacity))
+		}
+		entries = append(entries, entry)
+	}
+	entries = append(entries, html.EscapeString(fmt.Sprintf(m.cfg.msgs.lowWarnings, m.lowWarnings)))
+	m.lowWarnings = 0
+
+	notification := m.cfg.newNotification(eventDaily, deviceTypeBattery, "", lowest, 0)
+	notification.Summary = m.cfg.msgs.dailySummary
+	notification.Body = m.cfg.body(strings.Join(entries, "\n"))
+	notification.ReplacesID = m.dailyID
+	m.cfg.fitLengths(&notification)
+
+	if m.paused {
+		slog.Info("Skipping daily summary. Paused")
+		return
+	}
+
+	slog.Info("Sending daily summary")
+	id, err := m.notifier.SendNotification(notification)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	m.dailyID = id
+	m.recordHistory(eventDaily, notification, lowest, stateUnknown)
+	m.journal(eventDaily, notification, lowest, stateUnknown)
+	runHooks(ctx, m.cfg.hooks, eventDaily, lowest, stateUnknown)
+}
@@ -0,0 +1,123 @@
+package main
+
+import "time"
+
+// policy decides when a discharging battery calls for a low or critical
+// notification. It gathers the thresholds and the trigger settings in one
+// place, so that the decision does not depend on flags scattered around.
+type policy struct {
+	low, critical         float64
+	lowTime, criticalTime time.Duration
+
+	// trigger is level to update the notification on every new reading,
+	// or edge to only notify on crossing into an event and then every
+	// repeat, when set.
+	trigger string
+	repeat  time.Duration
+
+	// hysteresis is how many points above its threshold the level must
+	// rise before a battery notified about an event leaves it.
+	hysteresis float64
+}
+
+// policy returns the policy set by the flags of c.
+func (c *config) policy() policy {
+	return policy{
+		low:          c.thresholdLow,
+		critical:     c.thresholdCritical,
+		lowTime:      c.lowTime,
+		criticalTime: c.criticalTimeLimit(),
+		trigger:      c.trigger,
+		repeat:       c.repeatEvery,
+		hysteresis:   c.hysteresis,
+	}
+}
+
+// classify returns the event to notify for a discharging battery at
+// percentage with timeLeft until empty, or false when no notification is due.
+// Whichever of the level and time thresholds indicates more danger wins.
+func (p policy) classify(percentage float64, timeLeft time.Duration) (event, bool) {
+	switch {
+	case percentage <= p.critical || belowTime(timeLeft, p.criticalTime):
+		return eventCritical, true
+	case percentage <= p.low || belowTime(timeLeft, p.lowTime):
+		return eventLow, true
+	default:
+		return 0, false
+	}
+}
+
+// hold is classify for a battery last notified about notified, if ok, which
+// stays in that event until its level rises past the hysteresis, so that a
+// level wavering around a threshold does not notify again and again.
+func (p policy) hold(percentage float64, timeLeft time.Duration, notified event, ok bool) (event, bool) {
+	ev, low := p.classify(percentage, timeLeft)
+	if !ok || p.hysteresis == 0 {
+		return ev, low
+	}
+	if notified == eventCritical && ev != eventCritical && percentage <= p.critical+p.hysteresis {
+		return eventCritical, true
+	}
+	if !low && percentage <= p.low+p.hysteresis {
+		return eventLow, true
+	}
+	return ev, low
+}
+
+// due reports whether ev calls for a notification for a battery notified
+// about notified at notifiedAt, a zero time for none, when it is now.
+func (p policy) due(ev, notified event, notifiedAt, now time.Time) bool {
+	if p.trigger != "edge" || notifiedAt.IsZero() || ev != notified {
+		return true
+	}
+	return p.repeat > 0 && now.Sub(notifiedAt) >= p.repeat
+}
+
+// classify is the classify of the policy of c.
+func (c *config) classify(percentage float64, timeLeft time.Duration) (event, bool) {
+	return c.policy().classify(percentage, timeLeft)
+}
+
+// UPower warning levels, as reported by the WarningLevel property.
+const (
+	warningLevelLow      uint32 = 3
+	warningLevelCritical uint32 = 4
+	warningLevelAction   uint32 = 5
+)
+
+// classifyWarningLevel returns the event to notify for the warning level UPower
+// computed from its own thresholds, or false when no notification is due. The
+// action level, reached right before UPower acts, is critical too.
+func classifyWarningLevel(level uint32) (event, bool) {
+	switch level {
+	case warningLevelCritical, warningLevelAction:
+		return eventCritical, true
+	case warningLevelLow:
+		return eventLow, true
+	default:
+		return 0, false
+	}
+}
+
+// timeCritical reports whether timeLeft is below the critical time threshold.
+// UPower reports an unknown estimate as zero, which never counts as critical.
+func (c *config) timeCritical(timeLeft time.Duration) bool {
+	return belowTime(timeLeft, c.criticalTimeLimit())
+}
+
+// criticalTimeLimit returns the critical time threshold, the longer of the
+// times set with --critical and --critical-time, as whichever is reached first
+// fires.
+func (c *config) criticalTimeLimit() time.Duration {
+	return max(c.criticalTimeLeft, c.criticalTime)
+}
+
+// belowTime reports whether timeLeft is known and below limit, when set.
+func belowTime(timeLeft, limit time.Duration) bool {
+	return limit > 0 && timeLeft > 0 && timeLeft <= limit
+}
+
+// usesTime reports whether a threshold depends on the time to empty.
+func (c *config) usesTime() bool {
+	return c.criticalTimeLimit() > 0 || c.lowTime > 0
+}
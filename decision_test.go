@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPolicyClassify(t *testing.T) {
+	p := policy{low: 30, critical: 15, lowTime: 30 * time.Minute, criticalTime: 10 * time.Minute}
+	tests := []struct {
+		name       string
+		percentage float64
+		timeLeft   time.Duration
+		want       event
+		ok         bool
+	}{
+		{"fine", 50, 2 * time.Hour, 0, false},
+		{"just above low", 30.1, time.Hour, 0, false},
+		{"at low", 30, time.Hour, eventLow, true},
+		{"low", 20, time.Hour, eventLow, true},
+		{"just above critical", 15.1, time.Hour, eventLow, true},
+		{"at critical", 15, time.Hour, eventCritical, true},
+		{"empty", 0, 0, eventCritical, true},
+		{"low time", 50, 30 * time.Minute, eventLow, true},
+		{"critical time", 50, 10 * time.Minute, eventCritical, true},
+		{"critical time at a low level", 20, 5 * time.Minute, eventCritical, true},
+		{"critical level with time left", 10, 2 * time.Hour, eventCritical, true},
+		// UPower reports an unknown estimate as zero.
+		{"unknown time", 50, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		ev, ok := p.classify(tt.percentage, tt.timeLeft)
+		if ev != tt.want || ok != tt.ok {
+			t.Errorf("%s: classify(%g, %s) = %s, %t, want %s, %t", tt.name, tt.percentage, tt.timeLeft, ev, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestPolicyClassifyWithoutTime(t *testing.T) {
+	p := policy{low: 30, critical: 15}
+	if ev, ok := p.classify(50, time.Minute); ok {
+		t.Errorf("classify(50, 1m) without time thresholds = %s, want no event", ev)
+	}
+}
+
+func TestPolicyHold(t *testing.T) {
+	p := policy{low: 30, critical: 15, hysteresis: 3}
+	tests := []struct {
+		name       string
+		percentage float64
+		notified   event
+		ok         bool
+		want       event
+		wantOK     bool
+	}{
+		{"never notified", 32, 0, false, 0, false},
+		{"low within hysteresis", 32, eventLow, true, eventLow, true},
+		{"low at hysteresis", 33, eventLow, true, eventLow, true},
+		{"low past hysteresis", 33.1, eventLow, true, 0, false},
+		{"critical within hysteresis", 17, eventCritical, true, eventCritical, true},
+		{"critical past hysteresis", 18.1, eventCritical, true, eventLow, true},
+		{"critical far above", 40, eventCritical, true, 0, false},
+		{"low notified dropping to critical", 15, eventLow, true, eventCritical, true},
+		// A battery notified about low does not stay critical.
+		{"low notified above critical", 17, eventLow, true, eventLow, true},
+	}
+
+	for _, tt := range tests {
+		ev, ok := p.hold(tt.percentage, 0, tt.notified, tt.ok)
+		if ev != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: hold(%g, %s, %t) = %s, %t, want %s, %t", tt.name, tt.percentage, tt.notified, tt.ok, ev, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestPolicyHoldWithoutHysteresis(t *testing.T) {
+	p := policy{low: 30, critical: 15}
+	if ev, ok := p.hold(31, 0, eventLow, true); ok {
+		t.Errorf("hold(31) without hysteresis = %s, want no event", ev)
+	}
+	if ev, _ := p.hold(16, 0, eventCritical, true); ev != eventLow {
+		t.Errorf("hold(16) without hysteresis = %s, want %s", ev, eventLow)
+	}
+}
+
+func TestPolicyDue(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		p          policy
+		ev         event
+		notified   event
+		notifiedAt time.Time
+		want       bool
+	}{
+		{"level", policy{trigger: "level"}, eventLow, eventLow, now.Add(-time.Second), true},
+		{"edge, never notified", policy{trigger: "edge"}, eventLow, 0, time.Time{}, true},
+		{"edge, same event", policy{trigger: "edge"}, eventLow, eventLow, now.Add(-time.Hour), false},
+		{"edge, new event", policy{trigger: "edge"}, eventCritical, eventLow, now.Add(-time.Second), true},
+		{"edge, back to low", policy{trigger: "edge"}, eventLow, eventCritical, now.Add(-time.Second), true},
+		{"edge, before the repeat", policy{trigger: "edge", repeat: 10 * time.Minute}, eventLow, eventLow, now.Add(-9 * time.Minute), false},
+		{"edge, at the repeat", policy{trigger: "edge", repeat: 10 * time.Minute}, eventLow, eventLow, now.Add(-10 * time.Minute), true},
+		{"edge, after the repeat", policy{trigger: "edge", repeat: 10 * time.Minute}, eventLow, eventLow, now.Add(-time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.p.due(tt.ev, tt.notified, tt.notifiedAt, now); got != tt.want {
+			t.Errorf("%s: due(%s, %s) = %t, want %t", tt.name, tt.ev, tt.notified, got, tt.want)
+		}
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	cfg := newTestConfig(t, "--low", "25", "--critical", "10", "--critical-time", "5m", "--trigger", "edge", "--repeat-every", "15m", "--hysteresis", "2")
+	want := policy{
+		low:          25,
+		critical:     10,
+		criticalTime: 5 * time.Minute,
+		trigger:      "edge",
+		repeat:       15 * time.Minute,
+		hysteresis:   2,
+	}
+	if got := cfg.policy(); got != want {
+		t.Errorf("policy() = %+v, want %+v", got, want)
+	}
+}
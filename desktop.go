@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// upowerConfPath holds the thresholds UPower uses for its own warnings, which
+// GNOME shows since its settings daemon dropped its own.
+const upowerConfPath = "/etc/UPower/UPower.conf"
+
+// desktopThresholds returns the low and critical levels configured in the
+// power settings of the desktop, found from XDG_CURRENT_DESKTOP: Plasma's
+// PowerDevil, or else GNOME's settings daemon or UPower.
+func desktopThresholds() (low, critical float64, err error) {
+	if strings.Contains(os.Getenv("XDG_CURRENT_DESKTOP"), "KDE") {
+		return powerDevilThresholds()
+	}
+
+	if low, critical, err := gnomeThresholds(); err == nil {
+		return low, critical, nil
+	}
+
+	values, err := readIniSection(upowerConfPath, "UPower")
+	if err != nil {
+		return 0, 0, err
+	}
+	return parseThresholds(values, "PercentageLow", "PercentageCritical", 20, 5)
+}
+
+// powerDevilThresholds reads the battery levels of Plasma's power management.
+func powerDevilThresholds() (low, critical float64, err error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	values, err := readIniSection(filepath.Join(dir, "powerdevilrc"), "BatteryManagement")
+	if errors.Is(err, os.ErrNotExist) {
+		values = map[string]string{}
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return parseThresholds(values, "BatteryLowLevel", "BatteryCriticalLevel", 10, 5)
+}
+
+// gnomeThresholds reads the levels of older GNOME settings daemons, which
+// fails on releases leaving them to UPower.
+func gnomeThresholds() (low, critical float64, err error) {
+	get := func(key string) (float64, error) {
+		out, err := exec.Command("gsettings", "get", "org.gnome.settings-daemon.plugins.power", key).Output()
+		if err != nil {
+			return 0, err
+		}
+		// Unsigned values are printed with their type, e.g. "uint32 10".
+		fields := strings.Fields(string(out))
+		if len(fields) == 0 {
+			return 0, fmt.Errorf("empty value for %s", key)
+		}
+		return strconv.ParseFloat(fields[len(fields)-1], 64)
+	}
+
+	if low, err = get("percentage-low"); err != nil {
+		return 0, 0, err
+	}
+	if critical, err = get("percentage-critical"); err != nil {
+		return 0, 0, err
+	}
+	return low, critical, nil
+}
+
+// parseThresholds returns the levels under the keys low and critical of
+// values, defaulting to the given levels when missing.
+func parseThresholds(values map[string]string, lowKey, criticalKey string, low, critical float64) (float64, float64, error) {
+	for key, level := range map[string]*float64{lowKey: &low, criticalKey: &critical} {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		*level = n
+	}
+	return low, critical, nil
+}
+
+// readIniSection returns the "key=value" settings of the section named
+// section in the INI file at path.
+func readIniSection(path, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := map[string]string{}
+	var current string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			current = line[1 : len(line)-1]
+		case current == section:
+			if key, value, ok := strings.Cut(line, "="); ok {
+				values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// levelSample is a battery level read at some time.
+type levelSample struct {
+	at         time.Time
+	percentage float64
+}
+
+// drainWindow keeps the levels of a device over the last window to tell how
+// fast it drains.
+type drainWindow struct {
+	window  time.Duration
+	samples []levelSample
+}
+
+// add records percentage at time at, forgetting samples older than the window.
+func (w *drainWindow) add(at time.Time, percentage float64) {
+	w.samples = append(w.samples, levelSample{at, percentage})
+	for len(w.samples) > 0 && at.Sub(w.samples[0].at) > w.window {
+		w.samples = w.samples[1:]
+	}
+}
+
+// reset forgets every sample, e.g. when the device stops discharging.
+func (w *drainWindow) reset() {
+	w.samples = w.samples[:0]
+}
+
+// drop returns how many percentage points were lost over the window.
+func (w *drainWindow) drop() float64 {
+	if len(w.samples) < 2 {
+		return 0
+	}
+	return w.samples[0].percentage - w.samples[len(w.samples)-1].percentage
+}
+
+// checkDrain warns once per discharge when d loses the drain drop within the
+// drain window, even above the low threshold, as happens under heavy load.
+func (m *monitor) checkDrain(ctx context.Context, d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, percentage float64, timeLeft time.Duration) {
+	state, err := m.deviceState(ctx, d, obj, properties)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	if state != stateDischarging {
+		d.drain.reset()
+		d.drained = false
+		return
+	}
+
+	d.drain.add(m.clock.Now(), percentage)
+	if d.drained || d.drain.drop() < m.cfg.drainDrop {
+		return
+	}
+	d.drained = true
+	slog.Info(fmt.Sprintf("Battery dropped %.0f points within %s", d.drain.drop(), m.cfg.drainWindow))
+
+	var model string
+	if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+		slog.Error(err.Error())
+	}
+	model = m.cfg.modelName(path, model)
+
+	notification := m.cfg.newNotification(eventDrain, d.deviceType, model, percentage, timeLeft)
+	if _, err := m.send(d, eventDrain, notification, percentage, state); err != nil {
+		slog.Error(err.Error())
+	}
+	m.journal(eventDrain, notification, percentage, state)
+	runHooks(ctx, m.cfg.hooks, eventDrain, percentage, state)
+}
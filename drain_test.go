@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDrainWindow(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		// samples are levels, one a minute.
+		samples []float64
+		want    float64
+	}{
+		{"no samples", nil, 0},
+		{"one sample", []float64{80}, 0},
+		{"steady", []float64{80, 80, 80}, 0},
+		{"draining", []float64{80, 78, 75}, 5},
+		{"rising", []float64{70, 72}, -2},
+		// The window of five minutes keeps the last six samples.
+		{"older samples forgotten", []float64{90, 80, 79, 78, 77, 76, 75}, 5},
+		{"drop and recovery", []float64{80, 70, 80}, 0},
+	}
+
+	for _, tt := range tests {
+		w := drainWindow{window: 5 * time.Minute}
+		for i, percentage := range tt.samples {
+			w.add(start.Add(time.Duration(i)*time.Minute), percentage)
+		}
+		if got := w.drop(); got != tt.want {
+			t.Errorf("%s: drop() over %v = %g, want %g", tt.name, tt.samples, got, tt.want)
+		}
+	}
+}
+
+func TestDrainWindowReset(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := drainWindow{window: 5 * time.Minute}
+	w.add(start, 80)
+	w.add(start.Add(time.Minute), 70)
+	w.reset()
+	w.add(start.Add(2*time.Minute), 69)
+	if got := w.drop(); got != 0 {
+		t.Errorf("drop() after reset = %g, want 0", got)
+	}
+}
+
+func TestCheckDrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		levels   []float64
+		want     int
+	}{
+		{"fast", time.Minute, []float64{80, 76, 72, 68, 64}, 1},
+		{"slow", 5 * time.Minute, []float64{80, 76, 72, 68, 64}, 0},
+		{"once per discharge", time.Minute, []float64{80, 70, 60, 50, 40}, 1},
+	}
+
+	for _, tt := range tests {
+		m, notifier := newTestMonitor(t, "--drain-drop", "10", "--drain-window", "5m")
+		clk := newFakeClock(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+		m.clock = clk
+		for _, percentage := range tt.levels {
+			m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, percentage))
+			clk.Advance(tt.interval)
+		}
+
+		if len(notifier.sent) != tt.want {
+			t.Errorf("%s: sent %d notifications for levels %v every %s, want %d", tt.name, len(notifier.sent), tt.levels, tt.interval, tt.want)
+			continue
+		}
+		if tt.want > 0 && !strings.Contains(notifier.sent[0].Body, "draining fast") {
+			t.Errorf("%s: body = %q, want a drain warning", tt.name, notifier.sent[0].Body)
+		}
+	}
+}
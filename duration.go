@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// formatDuration formats d, rounded to the minute, in one of the styles
+// accepted by --duration-format: short (1h23m), clock (1:23) or minutes
+// (83 min).
+func formatDuration(d time.Duration, style string) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+
+	switch style {
+	case "clock":
+		return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+	case "minutes":
+		return fmt.Sprintf("%d min", minutes)
+	default:
+		if minutes < 60 {
+			return fmt.Sprintf("%dm", minutes)
+		}
+		return fmt.Sprintf("%dh%02dm", minutes/60, minutes%60)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		d     time.Duration
+		style string
+		want  string
+	}{
+		{0, "short", "0m"},
+		{29 * time.Second, "short", "0m"},
+		{30 * time.Second, "short", "1m"},
+		{59*time.Minute + 29*time.Second, "short", "59m"},
+		{59*time.Minute + 30*time.Second, "short", "1h00m"},
+		{83 * time.Minute, "short", "1h23m"},
+		{25*time.Hour + 5*time.Minute, "short", "25h05m"},
+		{5 * time.Minute, "clock", "0:05"},
+		{83*time.Minute + 40*time.Second, "clock", "1:24"},
+		{10 * time.Hour, "clock", "10:00"},
+		{90 * time.Second, "minutes", "2 min"},
+		{83 * time.Minute, "minutes", "83 min"},
+		{3 * time.Hour, "minutes", "180 min"},
+	}
+
+	for _, tt := range tests {
+		if got := formatDuration(tt.d, tt.style); got != tt.want {
+			t.Errorf("formatDuration(%s, %s) = %q, want %q", tt.d, tt.style, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// makeFifo creates the named pipe at path unless it already exists.
+func makeFifo(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if info.Mode()&os.ModeNamedPipe == 0 {
+			return fmt.Errorf("%s is not a named pipe", path)
+		}
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := ensureDir(path); err != nil {
+		return err
+	}
+
+	if err := syscall.Mkfifo(path, 0o644); err != nil {
+		return fmt.Errorf("creating %s: %w", path, err)
+	}
+	return nil
+}
+
+// writeFifo writes line to the named pipe at path without blocking. Nothing is
+// written, and no error returned, when no reader has the pipe open.
+func writeFifo(path, line string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(line + "\n")
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EPIPE) {
+		return nil
+	}
+	return err
+}
+
+// writeStatus writes the status line of d to the FIFO.
+func (m *monitor) writeStatus(ctx context.Context, d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, percentage float64, timeLeft time.Duration) {
+	state, err := m.deviceState(ctx, d, obj, properties)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	var model string
+	if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+		slog.Error(err.Error())
+	}
+
+	status := m.cfg.formatStatus(m.cfg.modelName(path, model), percentage, state, timeLeft, false)
+	if err := writeFifo(m.cfg.fifo, status); err != nil {
+		slog.Error(err.Error())
+	}
+}
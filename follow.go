@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// runFollow prints a line whenever a monitored device changes, stamped with
+// the time of clk, until ctx is done. It sends no notifications and is meant
+// for watching a discharge from a terminal, e.g. to measure the runtime of a
+// laptop.
+func runFollow(ctx context.Context, cfg *config, clk clock) error {
+	bus, err := connectSystemBus(cfg)
+	if err != nil {
+		return err
+	}
+	defer bus.conn.Close()
+
+	paths := cfg.devicePaths()
+	color := cfg.useColor(os.Stdout)
+	follow := func(path dbus.ObjectPath) {
+		properties, err := deviceProperties(bus.conn, path)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		fmt.Println(cfg.formatFollow(clk.Now(), path, properties, color))
+	}
+
+	for _, path := range paths {
+		follow(path)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case signal, ok := <-bus.signals:
+			if !ok {
+				return errors.New("lost connection to the system bus")
+			}
+			if slices.Contains(paths, signal.Path) {
+				follow(signal.Path)
+			}
+		}
+	}
+}
+
+// formatFollow describes the device at path at time now in a line such as
+// "15:04:05 BAT0: 45% Discharging, 2h10m left, 9.8 W", followed by the event
+// that would be notified, if any.
+func (c *config) formatFollow(now time.Time, path dbus.ObjectPath, properties map[string]dbus.Variant, color bool) string {
+	model, _ := properties["Model"].Value().(string)
+	percentage, _ := properties["Percentage"].Value().(float64)
+	state, _ := properties["State"].Value().(uint32)
+	timeToEmpty, _ := properties["TimeToEmpty"].Value().(int64)
+	rate, _ := properties["EnergyRate"].Value().(float64)
+
+	percentage = c.calibrate(percentage)
+	timeLeft := time.Duration(timeToEmpty) * time.Second
+
+	line := now.Format(time.TimeOnly) + " " + c.formatStatus(c.modelName(path, model), percentage, state, timeLeft, color)
+	if rate > 0 {
+		line += fmt.Sprintf(", %.1f W", rate)
+	}
+	if ev, ok := c.classify(percentage, timeLeft); ok && state == stateDischarging {
+		line += fmt.Sprintf(" [%s]", ev)
+	}
+	return line
+}
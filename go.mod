@@ -3,6 +3,7 @@ module github.com/piero-vic/battery-notify
 go 1.24.0
 
 require (
+	github.com/BurntSushi/toml v1.6.0
 	github.com/esiqveland/notify v0.13.3
 	github.com/godbus/dbus/v5 v5.1.0
 )
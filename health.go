@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// runHealth prints a report on the health of each device, without sending any
+// notification.
+func runHealth(cfg *config) error {
+	sysConn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("connecting to system bus: %w", err)
+	}
+	defer sysConn.Close()
+
+	for i, path := range cfg.devicePaths() {
+		properties, err := deviceProperties(sysConn, path)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		cfg.writeHealth(os.Stdout, path, properties)
+	}
+
+	return nil
+}
+
+// writeHealth writes the health report of the device at path to w. Lines for
+// properties the device does not report are left out.
+func (c *config) writeHealth(w io.Writer, path dbus.ObjectPath, properties map[string]dbus.Variant) {
+	model, _ := properties["Model"].Value().(string)
+	percentage, _ := properties["Percentage"].Value().(float64)
+	state, _ := properties["State"].Value().(uint32)
+	capacity, _ := properties["Capacity"].Value().(float64)
+	energyFull, _ := properties["EnergyFull"].Value().(float64)
+	energyFullDesign, _ := properties["EnergyFullDesign"].Value().(float64)
+	cycles, ok := properties["ChargeCycles"].Value().(int32)
+	if !ok {
+		cycles = -1
+	}
+
+	// Translated labels may be longer than the English ones.
+	msgs := c.msgs
+	width := 0
+	for _, label := range []string{msgs.healthLevel, msgs.healthState, msgs.healthCapacity, msgs.healthEnergyFull, msgs.healthCycles, msgs.healthGrade} {
+		width = max(width, utf8.RuneCountInString(label)+1)
+	}
+	line := func(label, format string, args ...any) {
+		fmt.Fprintf(w, "  %-*s %s\n", width, label+":", fmt.Sprintf(format, args...))
+	}
+
+	fmt.Fprintln(w, c.modelName(path, model))
+	line(msgs.healthLevel, "%s", c.formatPercentage(c.calibrate(percentage)))
+	line(msgs.healthState, "%s", msgs.state(state))
+	if capacity > 0 {
+		line(msgs.healthCapacity, msgs.healthOfDesign, capacity)
+	}
+	if energyFull > 0 && energyFullDesign > 0 {
+		line(msgs.healthEnergyFull, msgs.healthEnergy, energyFull, energyFullDesign)
+	}
+	if cycles >= 0 {
+		line(msgs.healthCycles, "%d", cycles)
+	}
+	if capacity > 0 {
+		line(msgs.healthGrade, "%s", msgs.grade(capacity))
+	}
+}
+
+// grade grades a battery by its capacity, the percentage of its design
+// capacity it still holds.
+func (m *messages) grade(capacity float64) string {
+	switch {
+	case capacity >= 80:
+		return m.healthGood
+	case capacity >= 60:
+		return m.healthFair
+	default:
+		return m.healthPoor
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// healthProperties are the properties of a battery of fair health.
+var healthProperties = map[string]dbus.Variant{
+	"Model":            dbus.MakeVariant("Test"),
+	"Percentage":       dbus.MakeVariant(80.0),
+	"State":            dbus.MakeVariant(stateDischarging),
+	"Capacity":         dbus.MakeVariant(75.0),
+	"EnergyFull":       dbus.MakeVariant(37.5),
+	"EnergyFullDesign": dbus.MakeVariant(50.0),
+	"ChargeCycles":     dbus.MakeVariant(int32(312)),
+}
+
+func TestWriteHealth(t *testing.T) {
+	cfg := newTestConfig(t)
+	var b strings.Builder
+	cfg.writeHealth(&b, testDevice, healthProperties)
+
+	want := `Test
+  Level:       80%
+  State:       Discharging
+  Capacity:    75% of design
+  Energy full: 37.5 Wh of 50.0 Wh
+  Cycles:      312
+  Health:      Fair
+`
+	if b.String() != want {
+		t.Errorf("writeHealth() wrote\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestWriteHealthTranslated(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	data := `health-level = "Stand"
+health-state = "Zustand"
+health-capacity = "Kapazität"
+health-of-design = "%.0f%% der Nennkapazität"
+health-energy-full = "Volle Energie"
+health-cycles = "Ladezyklen"
+health-grade = "Zustand des Akkus"
+health-fair = "Mittel"
+state-discharging = "Entlädt"
+`
+	path := filepath.Join(dir, appName, "messages", "de.toml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTestConfig(t)
+	msgs, err := loadMessages("de_DE.UTF-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.msgs = msgs
+
+	var b strings.Builder
+	cfg.writeHealth(&b, testDevice, healthProperties)
+
+	// The labels are aligned on the longest one, and the energy left
+	// untranslated stays in English.
+	want := `Test
+  Stand:             80%
+  Zustand:           Entlädt
+  Kapazität:         75% der Nennkapazität
+  Volle Energie:     37.5 Wh of 50.0 Wh
+  Ladezyklen:        312
+  Zustand des Akkus: Mittel
+`
+	if b.String() != want {
+		t.Errorf("writeHealth() wrote\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestGrade(t *testing.T) {
+	cfg := newTestConfig(t)
+	tests := []struct {
+		capacity float64
+		want     string
+	}{
+		{100, "Good"},
+		{80, "Good"},
+		{79.9, "Fair"},
+		{60, "Fair"},
+		{59.9, "Poor"},
+	}
+
+	for _, tt := range tests {
+		if got := cfg.msgs.grade(tt.capacity); got != tt.want {
+			t.Errorf("grade(%g) = %q, want %q", tt.capacity, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/esiqveland/notify"
+)
+
+// maxHistorySize is the size in bytes past which the history file is rotated
+// to a single backup.
+const maxHistorySize = 1 << 20
+
+// historyEntry is a line of the history file, written for every notification
+// sent.
+type historyEntry struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	Percentage float64   `json:"percentage"`
+	Urgency    string    `json:"urgency"`
+	State      string    `json:"state"`
+}
+
+// newHistoryEntry describes notification, sent at time at for ev while the
+// battery was at percentage and in state.
+func newHistoryEntry(at time.Time, ev event, notification notify.Notification, percentage float64, state uint32) historyEntry {
+	urgency := "normal"
+	if v, ok := notification.Hints["urgency"].Value().(byte); ok {
+		switch notify.Urgency(v) {
+		case notify.UrgencyLow:
+			urgency = "low"
+		case notify.UrgencyCritical:
+			urgency = "critical"
+		}
+	}
+
+	return historyEntry{
+		Time:       at,
+		Event:      ev.String(),
+		Percentage: percentage,
+		Urgency:    urgency,
+		State:      stateName(state),
+	}
+}
+
+// ensureDir creates the directory of the file at path and its parents, as
+// files under $XDG_STATE_HOME or $XDG_RUNTIME_DIR may be the first there.
+func ensureDir(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating the directory of %s: %w", path, err)
+	}
+	return nil
+}
+
+// appendHistory appends entry as a JSON line to the file at path. Once the file
+// grows past maxHistorySize it is moved to path.1, replacing any older backup.
+func appendHistory(path string, entry historyEntry) error {
+	if info, err := os.Stat(path); err == nil && info.Size() >= maxHistorySize {
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+
+	if err := ensureDir(path); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if err := json.NewEncoder(f).Encode(entry); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
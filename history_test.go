@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestEnsureDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state", "battery-notify", "history.jsonl")
+
+	// Creating the directories again must succeed too.
+	for range 2 {
+		if err := ensureDir(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Stat(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Errorf("%s is not a directory", filepath.Dir(path))
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("ensureDir created %s itself: %v", path, err)
+	}
+}
+
+func TestEnsureDirError(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ensureDir(filepath.Join(file, "history.jsonl")); err == nil {
+		t.Error("ensureDir() under a file succeeded, want an error")
+	}
+}
+
+func TestAppendHistoryCreatesDir(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "history.jsonl")
+	if err := appendHistory(path, historyEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error(err)
+	}
+}
+
+// readHistory returns the entries of the history file at path, none when it
+// does not exist.
+func readHistory(t *testing.T, path string) []historyEntry {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func TestHistoryFull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	m, _ := newTestMonitor(t, "--notify-full", "--history-file", path)
+
+	m.handleChanges(t.Context(), testDevice, stateProperties(stateCharging))
+	full := stateProperties(stateFullyCharged)
+	full["Model"] = dbus.MakeVariant("Test")
+	m.handleChanges(t.Context(), testDevice, full)
+
+	entries := readHistory(t, path)
+	if len(entries) != 1 {
+		t.Fatalf("recorded %d entries, want 1", len(entries))
+	}
+	if e := entries[0]; e.Event != eventFull.String() || e.Percentage != 100 || e.State != stateName(stateFullyCharged) {
+		t.Errorf("recorded %+v, want the full event at 100%%", e)
+	}
+}
+
+func TestHistoryUnchanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	m, notifier := newTestMonitor(t, "--history-file", path)
+
+	d := m.devices[testDevice]
+	notification := m.cfg.newNotification(eventLow, d.deviceType, "Test", 25, 0)
+	for range 2 {
+		if _, err := m.send(d, eventLow, notification, 25, stateDischarging); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(notifier.sent) != 1 {
+		t.Fatalf("sent %d notifications, want 1", len(notifier.sent))
+	}
+	if entries := readHistory(t, path); len(entries) != 1 {
+		t.Errorf("recorded %d entries, want 1", len(entries))
+	}
+}
+
+func TestHistoryUnlock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	m, _ := newTestMonitor(t, "--history-file", path)
+
+	m.setLocked(true)
+	m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+	if entries := readHistory(t, path); len(entries) != 0 {
+		t.Fatalf("recorded %d entries while locked, want 0", len(entries))
+	}
+
+	m.setLocked(false)
+	entries := readHistory(t, path)
+	if len(entries) != 1 {
+		t.Fatalf("recorded %d entries after unlocking, want 1", len(entries))
+	}
+	if e := entries[0]; e.Event != eventLow.String() || e.Percentage != 25 || e.State != stateName(stateDischarging) {
+		t.Errorf("recorded %+v, want the low event held back at 25%%", e)
+	}
+}
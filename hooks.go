@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// hookTimeout bounds how long a hook may run before it is killed.
+const hookTimeout = 10 * time.Second
+
+// runner runs hook commands with extra environment variables. It is swapped
+// out to check hooks without running them.
+type runner interface {
+	run(ctx context.Context, command string, env []string) error
+}
+
+// hookRunner runs every hook.
+var hookRunner runner = shellRunner{}
+
+// shellRunner runs commands through the shell, waiting for them to finish.
+type shellRunner struct{}
+
+func (shellRunner) run(ctx context.Context, command string, env []string) error {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+// runHook runs command with hookRunner. The battery status is passed in the
+// environment:
+//
+//	BATTERY_NOTIFY_EVENT       the event triggering the hook, e.g. "panic"
+//	BATTERY_NOTIFY_PERCENTAGE  the battery level, rounded to an integer
+//	BATTERY_NOTIFY_STATE       the UPower state, e.g. "Discharging"
+func runHook(ctx context.Context, command, ev string, percentage float64, state uint32) error {
+	return hookRunner.run(ctx, command, hookEnv(ev, percentage, state))
+}
+
+// hookEnv returns the environment variables describing the battery to hooks.
+func hookEnv(ev string, percentage float64, state uint32) []string {
+	return []string{
+		"BATTERY_NOTIFY_EVENT=" + ev,
+		fmt.Sprintf("BATTERY_NOTIFY_PERCENTAGE=%.0f", percentage),
+		"BATTERY_NOTIFY_STATE=" + stateName(state),
+	}
+}
+
+// hook is a command run on an event, only while the battery is in a state
+// matching when: charging, discharging or any.
+type hook struct {
+	ev      event
+	when    string
+	command string
+}
+
+// matches reports whether h runs for ev while the battery is in state.
+func (h hook) matches(ev event, state uint32) bool {
+	if h.ev != ev {
+		return false
+	}
+	switch h.when {
+	case "charging":
+		return state == stateCharging
+	case "discharging":
+		return state == stateDischarging
+	default:
+		return true
+	}
+}
+
+// hookList is a flag holding hooks, set as "event[:when]=command".
+type hookList []hook
+
+func (l *hookList) String() string {
+	if l == nil {
+		return ""
+	}
+	var hooks []string
+	for _, h := range *l {
+		hooks = append(hooks, h.ev.String()+":"+h.when+"="+h.command)
+	}
+	return strings.Join(hooks, ",")
+}
+
+func (l *hookList) Set(value string) error {
+	key, command, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected EVENT[:WHEN]=COMMAND, got %q", key)
+	}
+
+	name, when, ok := strings.Cut(key, ":")
+	if !ok {
+		when = "any"
+	}
+	switch when {
+	case "charging", "discharging", "any":
+	default:
+		return fmt.Errorf("invalid hook condition %q: must be charging, discharging or any", when)
+	}
+
+	ev, err := parseEvent(name)
+	if err != nil {
+		return err
+	}
+
+	*l = append(*l, hook{ev: ev, when: when, command: command})
+	return nil
+}
+
+// runHooks runs every hook of hooks matching ev in state, one after the other.
+func runHooks(ctx context.Context, hooks []hook, ev event, percentage float64, state uint32) {
+	for _, h := range hooks {
+		if !h.matches(ev, state) {
+			continue
+		}
+		slog.Info(fmt.Sprintf("Running %s hook", ev))
+		if err := runHook(ctx, h.command, ev.String(), percentage, state); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// fakeRunner records the hooks run instead of running them.
+type fakeRunner struct {
+	mu    sync.Mutex
+	calls []hookCall
+	err   error
+}
+
+// hookCall is a hook run by fakeRunner.
+type hookCall struct {
+	command string
+	env     []string
+}
+
+func (r *fakeRunner) run(ctx context.Context, command string, env []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, hookCall{command, env})
+	return r.err
+}
+
+// commands returns the commands run so far.
+func (r *fakeRunner) commands() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var commands []string
+	for _, call := range r.calls {
+		commands = append(commands, call.command)
+	}
+	return commands
+}
+
+// useFakeRunner makes hookRunner a fakeRunner until t ends.
+func useFakeRunner(t *testing.T) *fakeRunner {
+	t.Helper()
+	r := &fakeRunner{}
+	previous := hookRunner
+	hookRunner = r
+	t.Cleanup(func() {
+		hookRunner = previous
+	})
+	return r
+}
+
+func TestHookEnv(t *testing.T) {
+	want := []string{
+		"BATTERY_NOTIFY_EVENT=critical",
+		"BATTERY_NOTIFY_PERCENTAGE=8",
+		"BATTERY_NOTIFY_STATE=Discharging",
+	}
+	if got := hookEnv("critical", 7.6, stateDischarging); !slices.Equal(got, want) {
+		t.Errorf("hookEnv() = %q, want %q", got, want)
+	}
+}
+
+func TestHookMatches(t *testing.T) {
+	tests := []struct {
+		when  string
+		ev    event
+		state uint32
+		want  bool
+	}{
+		{"any", eventLow, stateDischarging, true},
+		{"any", eventLow, stateCharging, true},
+		{"any", eventCritical, stateDischarging, false},
+		{"charging", eventLow, stateCharging, true},
+		{"charging", eventLow, stateDischarging, false},
+		{"charging", eventLow, stateFullyCharged, false},
+		{"discharging", eventLow, stateDischarging, true},
+		{"discharging", eventLow, statePendingCharge, false},
+	}
+
+	for _, tt := range tests {
+		h := hook{ev: eventLow, when: tt.when, command: "true"}
+		if got := h.matches(tt.ev, tt.state); got != tt.want {
+			t.Errorf("low:%s hook matches(%s, %s) = %t, want %t", tt.when, tt.ev, stateName(tt.state), got, tt.want)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	r := useFakeRunner(t)
+	var hooks hookList
+	for _, value := range []string{"low=echo low", "low:charging=echo charging", "critical=echo critical", "low:discharging=echo discharging"} {
+		if err := hooks.Set(value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runHooks(t.Context(), hooks, eventLow, 25, stateDischarging)
+
+	if want := []string{"echo low", "echo discharging"}; !slices.Equal(r.commands(), want) {
+		t.Errorf("ran %q, want %q in order", r.commands(), want)
+	}
+	for _, call := range r.calls {
+		if !slices.Contains(call.env, "BATTERY_NOTIFY_EVENT=low") || !slices.Contains(call.env, "BATTERY_NOTIFY_PERCENTAGE=25") {
+			t.Errorf("%q ran with environment %q, want the event and level", call.command, call.env)
+		}
+	}
+}
+
+func TestRunHooksError(t *testing.T) {
+	r := useFakeRunner(t)
+	r.err = errors.New("exit status 1")
+	hooks := hookList{{ev: eventLow, when: "any", command: "false"}, {ev: eventLow, when: "any", command: "true"}}
+
+	// A failing hook does not stop the next ones.
+	runHooks(t.Context(), hooks, eventLow, 25, stateDischarging)
+	if want := []string{"false", "true"}; !slices.Equal(r.commands(), want) {
+		t.Errorf("ran %q, want %q", r.commands(), want)
+	}
+}
+
+func TestHooksOnLow(t *testing.T) {
+	r := useFakeRunner(t)
+	m, _ := newTestMonitor(t, "--hook", "low=echo low", "--hook", "critical=echo critical")
+
+	m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+	if want := []string{"echo low"}; !slices.Equal(r.commands(), want) {
+		t.Errorf("ran %q at 25%%, want %q", r.commands(), want)
+	}
+}
+
+func TestPanicHook(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"level thresholds", nil},
+		// The time left is unknown, so the time thresholds give no event.
+		{"time thresholds", []string{"--low", "20m", "--critical", "5m"}},
+	}
+
+	for _, tt := range tests {
+		r := useFakeRunner(t)
+		m, _ := newTestMonitor(t, append([]string{"--panic-exec", "sync", "--panic-threshold", "5"}, tt.args...)...)
+
+		for _, percentage := range []float64{6, 5, 4} {
+			m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, percentage))
+		}
+		if want := []string{"sync"}; !slices.Equal(r.commands(), want) {
+			t.Errorf("%s: ran %q down to 4%%, want %q once", tt.name, r.commands(), want)
+		}
+
+		// Charging starts a new discharge cycle.
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateCharging, 4))
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 4))
+		if len(r.commands()) != 2 {
+			t.Errorf("%s: ran %q after charging, want the panic hook again", tt.name, r.commands())
+		}
+	}
+}
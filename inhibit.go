@@ -0,0 +1,44 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const dbusCallInhibit = login1ManagerInterface + ".Inhibit"
+
+// inhibitIdle takes a logind lock keeping the screen from blanking while the
+// battery of d is critical, so that the warning is seen. The lock lasts until
+// releaseIdle closes it.
+func (m *monitor) inhibitIdle(d *device) {
+	if d.idleLock != nil {
+		return
+	}
+
+	var fd dbus.UnixFD
+	err := m.sysConn.Object(login1Service, login1Path).
+		Call(dbusCallInhibit, 0, "idle", appName, "Battery level is critical", "block").
+		Store(&fd)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	slog.Info("Inhibiting idle")
+	d.idleLock = os.NewFile(uintptr(fd), "inhibitor")
+}
+
+// releaseIdle releases the lock taken by inhibitIdle for d, if any.
+func (m *monitor) releaseIdle(d *device) {
+	if d.idleLock == nil {
+		return
+	}
+
+	slog.Info("Releasing idle inhibitor")
+	if err := d.idleLock.Close(); err != nil {
+		slog.Error(err.Error())
+	}
+	d.idleLock = nil
+}
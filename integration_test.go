@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/piero-vic/battery-notify/internal/testutil"
+)
+
+// startBuses starts private system and session buses, used by the code under
+// test through the environment, with UPower exporting a battery discharging
+// at 50%.
+func startBuses(t *testing.T) (system, session *testutil.Bus, upower *testutil.UPower) {
+	t.Helper()
+
+	system, session = testutil.StartBus(t), testutil.StartBus(t)
+	upower = testutil.NewUPower(t, system, map[dbus.ObjectPath]map[string]any{
+		testDevice: {
+			"Type":        deviceTypeBattery,
+			"PowerSupply": true,
+			"IsPresent":   true,
+			"NativePath":  "BAT0",
+			"Model":       "Test",
+			"State":       stateDischarging,
+			"Percentage":  50.0,
+			"TimeToEmpty": int64(3 * 3600),
+		},
+	})
+	t.Setenv("DBUS_SYSTEM_BUS_ADDRESS", system.Address)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", session.Address)
+	return system, session, upower
+}
+
+// startDaemon connects to the buses as run does and runs listen until
+// cancel is called, returning the channel receiving its result.
+func startDaemon(t *testing.T, cfg *config) (cancel context.CancelFunc, done <-chan error) {
+	t.Helper()
+
+	bus, err := connectSystemBus(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		bus.conn.Close()
+	})
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := newMonitor(cfg, bus.conn, notifier, cfg.devicePaths())
+	t.Cleanup(func() {
+		m.notifier.Close()
+	})
+	m.readDevices()
+	watch, err := watchNotificationServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		watch.Close()
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	result := make(chan error, 1)
+	go func() {
+		result <- listen(ctx, cfg, m, bus, watch)
+	}()
+	return cancel, result
+}
+
+func TestIntegration(t *testing.T) {
+	_, session, upower := startBuses(t)
+	notifications := testutil.NewNotifications(t, session, "body", "body-markup", "x-canonical-private-synchronous")
+	cancel, done := startDaemon(t, newTestConfig(t))
+
+	upower.Change(t, testDevice, map[string]any{"Percentage": 25.0, "TimeToEmpty": int64(3600)})
+	sent := notifications.WaitSent(t, 1)
+	if !strings.Contains(sent[0].Body, "25%") {
+		t.Errorf("body = %q, want the level of 25%%", sent[0].Body)
+	}
+	if got := sent[0].Hints["value"].Value(); got != int32(25) {
+		t.Errorf("value hint = %v (%T), want 25", got, got)
+	}
+
+	upower.Change(t, testDevice, map[string]any{"State": stateCharging})
+	upower.Change(t, testDevice, map[string]any{"State": stateFullyCharged, "Percentage": 100.0})
+	if closed := notifications.WaitClosed(t, 1); !slices.Contains(closed, uint32(1)) {
+		t.Errorf("closed %v, want the low battery notification 1 closed", closed)
+	}
+
+	cancel()
+	waitListen(t, done)
+}
+
+func TestChargingReadsNoProperties(t *testing.T) {
+	_, session, upower := startBuses(t)
+	notifications := testutil.NewNotifications(t, session)
+	// Dropped signals would be caught up on with every property at once.
+	cancel, done := startDaemon(t, newTestConfig(t, "--signal-buffer", "100"))
+	defer func() {
+		cancel()
+		waitListen(t, done)
+	}()
+
+	upower.Change(t, testDevice, map[string]any{"State": stateCharging, "Percentage": 60.0})
+	for percentage := 61.0; percentage <= 70; percentage++ {
+		upower.Change(t, testDevice, map[string]any{"Percentage": percentage})
+	}
+
+	// Signals are handled in order, so once the notification of a signal
+	// carrying everything read comes, the charging ones were handled.
+	upower.Change(t, testDevice, map[string]any{
+		"Model":       "Test",
+		"State":       stateDischarging,
+		"Percentage":  25.0,
+		"TimeToEmpty": int64(3600),
+	})
+	notifications.WaitSent(t, 1)
+
+	for _, name := range []string{"Model", "Percentage", "State"} {
+		if gets := upower.Gets(testDevice, name); gets != 0 {
+			t.Errorf("read %s %d times, want none while charging above the low level", name, gets)
+		}
+	}
+}
+
+func TestNotificationServerRestart(t *testing.T) {
+	_, session, upower := startBuses(t)
+	first := testutil.NewNotifications(t, session)
+	cancel, done := startDaemon(t, newTestConfig(t))
+	defer func() {
+		cancel()
+		waitListen(t, done)
+	}()
+
+	upower.Change(t, testDevice, map[string]any{"Percentage": 25.0})
+	first.WaitSent(t, 1)
+
+	first.Close()
+	second := testutil.NewNotifications(t, session)
+
+	// Levels reported before the notifier is rebuilt go to the server that
+	// exited, or reach the new one still replacing the notification shown by
+	// the previous server, so the level keeps dropping until the new one gets
+	// a notification of its own.
+	deadline := time.Now().Add(5 * time.Second)
+	for percentage := 24.0; !slices.ContainsFunc(second.Sent(), isNew); percentage-- {
+		if time.Now().After(deadline) {
+			t.Fatalf("the new notification server got %v, want a new notification", second.Sent())
+		}
+		upower.Change(t, testDevice, map[string]any{"Percentage": percentage})
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// isNew reports whether n replaces no notification.
+func isNew(n testutil.Notification) bool {
+	return n.ReplacesID == 0
+}
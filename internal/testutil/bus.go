@@ -0,0 +1,99 @@
+// Package testutil runs a private D-Bus daemon with fake UPower and
+// notification services, for tests to drive battery-notify end to end.
+package testutil
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const busConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-BUS Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:dir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow own="*"/>
+    <allow send_destination="*"/>
+    <allow receive_sender="*"/>
+  </policy>
+</busconfig>
+`
+
+// Bus is a private D-Bus daemon, stopped when its test ends.
+type Bus struct {
+	// Address is the D-Bus address clients connect to.
+	Address string
+}
+
+// StartBus starts a private D-Bus daemon for t, skipping t when dbus-daemon
+// is not installed.
+func StartBus(t testing.TB) *Bus {
+	t.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+
+	dir := t.TempDir()
+	config := filepath.Join(dir, "bus.conf")
+	if err := os.WriteFile(config, fmt.Appendf(nil, busConfig, dir), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+config, "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("starting dbus-daemon: %s", err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the address of dbus-daemon: %s", err)
+	}
+	return &Bus{Address: strings.TrimSpace(address)}
+}
+
+// Connect returns a new connection to b, closed when t ends.
+func (b *Bus) Connect(t testing.TB) *dbus.Conn {
+	t.Helper()
+
+	conn, err := dbus.Connect(b.Address)
+	if err != nil {
+		t.Fatalf("connecting to %s: %s", b.Address, err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return conn
+}
+
+// requestName makes conn the owner of name, failing t otherwise. Services
+// export their objects first, so that clients finding the name can call them.
+func requestName(t testing.TB, conn *dbus.Conn, name string) {
+	t.Helper()
+
+	reply, err := conn.RequestName(name, dbus.NameFlagDoNotQueue)
+	if err != nil {
+		t.Fatalf("requesting %s: %s", name, err)
+	}
+	if reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("requesting %s: the name has another owner", name)
+	}
+}
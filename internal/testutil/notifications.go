@@ -0,0 +1,148 @@
+package testutil
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsService = "org.freedesktop.Notifications"
+	notificationsPath    = dbus.ObjectPath("/org/freedesktop/Notifications")
+)
+
+// Notification is a notification received by Notifications.
+type Notification struct {
+	AppName    string
+	ReplacesID uint32
+	AppIcon    string
+	Summary    string
+	Body       string
+	Actions    []string
+	Hints      map[string]dbus.Variant
+	Timeout    int32
+}
+
+// Notifications is a fake notification server recording the notifications
+// sent and closed. It hands out IDs from 1 and keeps the ID of replaced
+// notifications.
+type Notifications struct {
+	conn         *dbus.Conn
+	capabilities []string
+
+	mu     sync.Mutex
+	sent   []Notification
+	closed []uint32
+	lastID uint32
+}
+
+// notificationServer implements the methods of org.freedesktop.Notifications,
+// leaving those of Notifications to the test.
+type notificationServer struct {
+	n *Notifications
+}
+
+func (s notificationServer) Notify(appName string, replacesID uint32, appIcon, summary, body string, actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	n := s.n
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.sent = append(n.sent, Notification{
+		AppName:    appName,
+		ReplacesID: replacesID,
+		AppIcon:    appIcon,
+		Summary:    summary,
+		Body:       body,
+		Actions:    actions,
+		Hints:      hints,
+		Timeout:    timeout,
+	})
+	if replacesID != 0 {
+		return replacesID, nil
+	}
+	n.lastID++
+	return n.lastID, nil
+}
+
+func (s notificationServer) CloseNotification(id uint32) *dbus.Error {
+	n := s.n
+	n.mu.Lock()
+	n.closed = append(n.closed, id)
+	n.mu.Unlock()
+
+	// The reason 3 tells the notification was closed by CloseNotification.
+	n.conn.Emit(notificationsPath, notificationsService+".NotificationClosed", id, uint32(3))
+	return nil
+}
+
+func (s notificationServer) GetCapabilities() ([]string, *dbus.Error) {
+	return s.n.capabilities, nil
+}
+
+func (s notificationServer) GetServerInformation() (string, string, string, string, *dbus.Error) {
+	return "testutil", "battery-notify", "1.0", "1.2", nil
+}
+
+// NewNotifications runs a notification server on bus, with capabilities.
+func NewNotifications(t testing.TB, bus *Bus, capabilities ...string) *Notifications {
+	t.Helper()
+
+	n := &Notifications{conn: bus.Connect(t), capabilities: capabilities}
+	if err := n.conn.Export(notificationServer{n}, notificationsPath, notificationsService); err != nil {
+		t.Fatalf("exporting %s: %s", notificationsPath, err)
+	}
+	requestName(t, n.conn, notificationsService)
+	return n
+}
+
+// Close stops the server, releasing its name as when a notification daemon
+// exits.
+func (n *Notifications) Close() {
+	n.conn.Close()
+}
+
+// Sent returns the notifications sent so far.
+func (n *Notifications) Sent() []Notification {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.sent)
+}
+
+// Closed returns the IDs of the notifications closed so far.
+func (n *Notifications) Closed() []uint32 {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return slices.Clone(n.closed)
+}
+
+// WaitSent waits until count notifications were sent, returning them, and
+// fails t if they are not within a few seconds.
+func (n *Notifications) WaitSent(t testing.TB, count int) []Notification {
+	t.Helper()
+	waitFor(t, "notifications sent", count, func() int { return len(n.Sent()) })
+	return n.Sent()
+}
+
+// WaitClosed waits until count notifications were closed, returning their
+// IDs, and fails t if they are not within a few seconds.
+func (n *Notifications) WaitClosed(t testing.TB, count int) []uint32 {
+	t.Helper()
+	waitFor(t, "notifications closed", count, func() int { return len(n.Closed()) })
+	return n.Closed()
+}
+
+// waitFor polls got until it returns at least want, failing t after a few
+// seconds.
+func waitFor(t testing.TB, what string, want int, got func() int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for got() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d %s, want %d", got(), what, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
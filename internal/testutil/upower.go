@@ -0,0 +1,123 @@
+package testutil
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	upowerService         = "org.freedesktop.UPower"
+	upowerPath            = dbus.ObjectPath("/org/freedesktop/UPower")
+	upowerDeviceInterface = "org.freedesktop.UPower.Device"
+)
+
+// UPower is a fake UPower service exporting a fixed set of devices, whose
+// properties change when the test says. It counts the properties read one at
+// a time, for tests to check the bus traffic.
+type UPower struct {
+	conn *dbus.Conn
+
+	mu      sync.Mutex
+	devices map[dbus.ObjectPath]*prop.Properties
+	gets    map[dbus.ObjectPath]map[string]int
+}
+
+// countingProperties is the Properties interface of a device, counting the
+// calls to Get.
+type countingProperties struct {
+	*prop.Properties
+	u    *UPower
+	path dbus.ObjectPath
+}
+
+func (p countingProperties) Get(iface, property string) (dbus.Variant, *dbus.Error) {
+	p.u.mu.Lock()
+	p.u.gets[p.path][property]++
+	p.u.mu.Unlock()
+	return p.Properties.Get(iface, property)
+}
+
+// upowerManager implements the methods of org.freedesktop.UPower.
+type upowerManager struct {
+	paths []dbus.ObjectPath
+}
+
+func (m upowerManager) EnumerateDevices() ([]dbus.ObjectPath, *dbus.Error) {
+	return m.paths, nil
+}
+
+// NewUPower exports devices, the properties of each device by object path, as
+// the UPower service of bus.
+func NewUPower(t testing.TB, bus *Bus, devices map[dbus.ObjectPath]map[string]any) *UPower {
+	t.Helper()
+
+	u := &UPower{
+		conn:    bus.Connect(t),
+		devices: map[dbus.ObjectPath]*prop.Properties{},
+		gets:    map[dbus.ObjectPath]map[string]int{},
+	}
+	var manager upowerManager
+	for path, properties := range devices {
+		props := map[string]*prop.Prop{}
+		for name, value := range properties {
+			// Change emits the signal, with every property changed at once.
+			props[name] = &prop.Prop{Value: value, Emit: prop.EmitFalse}
+		}
+		exported, err := prop.Export(u.conn, path, prop.Map{upowerDeviceInterface: props})
+		if err != nil {
+			t.Fatalf("exporting %s: %s", path, err)
+		}
+		// The counting interface replaces the one exported by prop.
+		counting := countingProperties{Properties: exported, u: u, path: path}
+		if err := u.conn.Export(counting, path, "org.freedesktop.DBus.Properties"); err != nil {
+			t.Fatalf("exporting %s: %s", path, err)
+		}
+		u.devices[path] = exported
+		u.gets[path] = map[string]int{}
+		manager.paths = append(manager.paths, path)
+	}
+	slices.Sort(manager.paths)
+
+	if err := u.conn.Export(manager, upowerPath, upowerService); err != nil {
+		t.Fatalf("exporting %s: %s", upowerPath, err)
+	}
+	requestName(t, u.conn, upowerService)
+	return u
+}
+
+// Change sets the properties of the device at path, emitting a single
+// PropertiesChanged signal as UPower does. It panics unless NewUPower exported
+// the properties, with the same types.
+func (u *UPower) Change(t testing.TB, path dbus.ObjectPath, properties map[string]any) {
+	t.Helper()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	device, ok := u.devices[path]
+	if !ok {
+		t.Fatalf("changing %s: no such device", path)
+	}
+	changed := map[string]dbus.Variant{}
+	for name, value := range properties {
+		device.SetMust(upowerDeviceInterface, name, value)
+		changed[name] = dbus.MakeVariant(value)
+	}
+
+	err := u.conn.Emit(path, "org.freedesktop.DBus.Properties.PropertiesChanged", upowerDeviceInterface, changed, []string{})
+	if err != nil {
+		t.Fatalf("signaling the change of %s: %s", path, err)
+	}
+}
+
+// Gets returns the number of times the property name of the device at path
+// was read with Get.
+func (u *UPower) Gets(path dbus.ObjectPath, name string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.gets[path][name]
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// journalSocket is where journald accepts entries in its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalMessageIDs identify each event in the journal, so that entries can be
+// queried with e.g. journalctl MESSAGE_ID=366fc5985ec948e6980ce722a7b09d4f.
+var journalMessageIDs = map[event]string{
+	eventLow:      "c03debefe5f14d969500849229ae2901",
+	eventCritical: "366fc5985ec948e6980ce722a7b09d4f",
+	eventFull:     "da50f30e1a8140238d46881b6bb41937",
+	eventRemoved:  "5da1d403e8a849a4bb1f782b6450f84f",
+	eventCharger:  "9ca334a646d24fd095aaf8b3a4b4feee",
+	eventDrain:    "e4e996cf532c44b19846809c9d2c8c8f",
+	eventLimit:    "5b0f3c7d1e8a4f62a9d4c0e6b7183f25",
+	eventDaily:    "a61d2e94c7b54f0e8b3f5d17c2e9a048",
+	eventStep:     "3c8e5f1a9b2d4e7f8a6c0d3b5e9f1a27",
+}
+
+// journalPriorities are the syslog priorities of the events, which default to
+// notice.
+var journalPriorities = map[event]int{
+	eventLow:      4, // warning
+	eventCritical: 2, // crit
+	eventFull:     6, // info
+}
+
+// journalEvent writes ev as a structured journal entry, described by entry.
+// None of the values contain newlines, which would need the binary encoding of
+// the protocol.
+func journalEvent(ev event, entry historyEntry) error {
+	priority, ok := journalPriorities[ev]
+	if !ok {
+		priority = 5
+	}
+
+	fields := []string{
+		fmt.Sprintf("MESSAGE=Battery %s at %.0f%%", entry.Event, entry.Percentage),
+		"MESSAGE_ID=" + journalMessageIDs[ev],
+		fmt.Sprintf("PRIORITY=%d", priority),
+		"SYSLOG_IDENTIFIER=" + appName,
+		"BATTERY_EVENT=" + entry.Event,
+		fmt.Sprintf("BATTERY_PERCENT=%.0f", entry.Percentage),
+		"BATTERY_STATE=" + entry.State,
+		"BATTERY_URGENCY=" + entry.Urgency,
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(fields, "\n") + "\n"))
+	return err
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+// checkChargeLimit warns when d keeps charging at or above the charge limit,
+// and closes the warning once it stops charging. Reminders are sent by
+// remindChargeLimit while the warning is up.
+func (m *monitor) checkChargeLimit(ctx context.Context, d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, percentage float64) {
+	state, err := m.deviceState(ctx, d, obj, properties)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	over := state == stateCharging && percentage >= m.cfg.chargeLimit
+	if !over {
+		if d.overLimit {
+			d.overLimit = false
+			m.closeChargeLimit(d)
+		}
+		return
+	}
+
+	d.limitLevel = percentage
+	if m.cfg.showTimeToFull {
+		var timeToFull int64
+		if err := deviceProperty(obj, properties, "TimeToFull", &timeToFull); err != nil {
+			slog.Error(err.Error())
+		}
+		d.timeToFull = time.Duration(timeToFull) * time.Second
+	}
+	if m.cfg.showChargeRate {
+		if err := deviceProperty(obj, properties, "EnergyRate", &d.chargeRate); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+	if d.overLimit {
+		return
+	}
+	d.overLimit = true
+
+	var model string
+	if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+		slog.Error(err.Error())
+	}
+	d.limitModel = m.cfg.modelName(path, model)
+
+	notification := m.limitNotification(d)
+	if _, err := m.send(d, eventLimit, notification, percentage, state); err != nil {
+		slog.Error(err.Error())
+	}
+	m.journal(eventLimit, notification, percentage, state)
+	runHooks(ctx, m.cfg.hooks, eventLimit, percentage, state)
+}
+
+// limitNotification returns the charge limit warning of d, telling how fast
+// it charges with --show-charge-rate so that weak chargers stand out.
+func (m *monitor) limitNotification(d *device) notify.Notification {
+	notification := m.cfg.newNotification(eventLimit, d.deviceType, d.limitModel, d.limitLevel, d.timeToFull)
+	if m.cfg.showChargeRate && d.chargeRate != 0 {
+		rate := fmt.Sprintf(m.cfg.msgs.chargeRate, math.Abs(d.chargeRate))
+		notification.Body += ", " + m.cfg.body(html.EscapeString(rate))
+		m.cfg.fitLengths(&notification)
+	}
+	return notification
+}
+
+// remindChargeLimit sends the charge limit warning again, as critical, for
+// every device still charging past the limit.
+func (m *monitor) remindChargeLimit() {
+	for _, d := range m.devices {
+		if !d.overLimit {
+			continue
+		}
+
+		slog.Info("Still charging past the charge limit")
+		notification := m.limitNotification(d)
+		notification.SetUrgency(notify.UrgencyCritical)
+
+		// A reminder must show up again even when nothing changed.
+		delete(d.contentHashes, m.notificationKey(eventLimit))
+		if _, err := m.send(d, eventLimit, notification, d.limitLevel, stateCharging); err != nil {
+			slog.Error(err.Error())
+		}
+	}
+}
+
+// closeChargeLimit closes the charge limit warning of d.
+func (m *monitor) closeChargeLimit(d *device) {
+	key := m.notificationKey(eventLimit)
+	id, ok := d.notificationIDs[key]
+	if !ok {
+		return
+	}
+
+	slog.Info("Closing charge limit notification")
+	if _, err := m.notifier.CloseNotification(id); err != nil {
+		slog.Error(err.Error())
+	}
+	delete(d.notificationIDs, key)
+	delete(d.contentHashes, key)
+}
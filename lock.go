@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// lockInstance makes sure a single daemon runs per user by listening on an
+// abstract Unix socket. The kernel releases the socket when the process
+// exits, so a crash never leaves a stale lock behind.
+func lockInstance() (net.Listener, error) {
+	listener, err := net.Listen("unix", fmt.Sprintf("@%s-%d", appName, os.Getuid()))
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return nil, fmt.Errorf("%s is already running, pass --single-instance=false to run several instances", appName)
+	}
+	return listener, err
+}
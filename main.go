@@ -2,25 +2,27 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
-	"math"
+	"maps"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
-	"github.com/esiqveland/notify"
 	"github.com/godbus/dbus/v5"
 )
 
 const (
 	appName     = "battery-notify"
-	batteryPath = dbus.ObjectPath("/org/freedesktop/UPower/devices/battery_BAT0")
+	devicesPath = "/org/freedesktop/UPower/devices/"
 )
 
 const (
-	stateCharging uint32 = iota + 1
+	stateUnknown uint32 = iota
+	stateCharging
 	stateDischarging
 	stateEmpty
 	stateFullyCharged
@@ -29,11 +31,14 @@ const (
 )
 
 const (
+	dbusUPowerService         = "org.freedesktop.UPower"
 	dbusUPowerDeviceInterface = "org.freedesktop.UPower.Device"
 	dbusCallPropertiesGet     = "org.freedesktop.DBus.Properties.Get"
+	dbusCallPropertiesGetAll  = "org.freedesktop.DBus.Properties.GetAll"
 )
 
 var stateMap = map[uint32]string{
+	stateUnknown:          "Unknown",
 	stateCharging:         "Charging",
 	stateDischarging:      "Discharging",
 	stateEmpty:            "Empty",
@@ -42,10 +47,14 @@ var stateMap = map[uint32]string{
 	statePendingDischarge: "Pending Discharge",
 }
 
-const usage = `Usage:
-  -c, --critical  float  Threshold for critical battery level. Default is 15.
-  -l, --low       float  Threshold for low battery level. Default is 30.
-`
+// stateName returns the name of state, or "Unknown(n)" for a state UPower
+// did not define when this was written.
+func stateName(state uint32) string {
+	if name, ok := stateMap[state]; ok {
+		return name
+	}
+	return fmt.Sprintf("Unknown(%d)", state)
+}
 
 func main() {
 	if err := run(); err != nil {
@@ -56,142 +65,265 @@ func main() {
 
 func run() error {
 	flag.Usage = func() {
-		fmt.Fprint(os.Stderr, usage)
+		printUsage(os.Stderr, flag.CommandLine)
 	}
 
-	var (
-		thresholdCritital float64
-		thresholdLow      float64
-	)
-
-	flag.Float64Var(&thresholdLow, "l", 30, "Threshold for low battery level.")
-	flag.Float64Var(&thresholdLow, "low", 30, "Threshold for low battery level.")
-	flag.Float64Var(&thresholdCritital, "c", 15, "Threshold for critical battery level.")
-	flag.Float64Var(&thresholdCritital, "critical", 15, "Threshold for critical battery level.")
+	var cfg config
+	cfg.registerFlags(flag.CommandLine)
+	if err := loadConfigFiles(flag.CommandLine, configPaths(os.Args[1:])); err != nil {
+		return err
+	}
 	flag.Parse()
 
+	// Flags may also follow the command.
+	command := flag.Arg(0)
+	if command == "completion" {
+		return runCompletion(os.Stdout, flag.CommandLine, flag.Arg(1))
+	}
+	if command != "" {
+		flag.CommandLine.Parse(flag.Args()[1:])
+	}
+
+	if cfg.desktopThresholds {
+		low, critical, err := desktopThresholds()
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Could not read the desktop thresholds, using the configured ones: %s", err))
+		} else {
+			cfg.thresholdLow, cfg.thresholdCritical = low, critical
+		}
+	}
+
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+
+	msgs, err := loadMessages(messagesLocale())
+	if err != nil {
+		return err
+	}
+	cfg.msgs = msgs
+	maps.Copy(cfg.msgs.states, cfg.stateNames)
+
+	// Testing, simulating and dumping the capabilities only talk to the
+	// notification server, so they do not look for a battery.
+	needsBattery := command != "test" && command != "simulate" && !cfg.dumpCapabilities
+	if cfg.displayDevice {
+		cfg.device = displayDeviceName
+	} else if (cfg.device == "auto" || cfg.device == "all") && needsBattery {
+		cfg.device = autoDevice(&cfg)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
 	if flag.NArg() > 0 {
 		flag.Usage()
 		return nil
 	}
 
-	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer cancel()
+	if cfg.dumpCapabilities {
+		return runDumpCapabilities(&cfg)
+	}
+	if cfg.follow {
+		return runFollow(ctx, &cfg, systemClock{})
+	}
 
-	sysConn, err := dbus.SystemBus()
-	if err != nil {
-		return err
+	switch command {
+	case "":
+	case "test":
+		return runTest(ctx, &cfg, systemClock{})
+	case "status":
+		return runStatus(&cfg)
+	case "probe":
+		return runProbe(&cfg)
+	case "health":
+		return runHealth(&cfg)
+	case "simulate":
+		return runSimulate(ctx, &cfg)
+	default:
+		flag.Usage()
+		return nil
+	}
+
+	// Notifications go to the session bus of the user running the daemon,
+	// which root rarely has, so running as root is mostly a unit file in
+	// the wrong place.
+	if os.Getuid() == 0 && !cfg.allowRoot {
+		return errors.New("refusing to run as root, whose session rarely shows notifications: run battery-notify as a user service or pass --allow-root")
 	}
-	defer sysConn.Close()
 
-	sessionConn, err := dbus.SessionBus()
+	if cfg.singleInstance {
+		lock, err := lockInstance()
+		if err != nil {
+			return err
+		}
+		defer lock.Close()
+	}
+
+	if cfg.fifo != "" {
+		if err := makeFifo(cfg.fifo); err != nil {
+			return err
+		}
+	}
+
+	if cfg.withoutUPower() {
+		return runSysfsOnly(ctx, &cfg)
+	}
+
+	bus, err := connectSystemBus(&cfg)
 	if err != nil {
 		return err
 	}
-	defer sessionConn.Close()
+	defer func() {
+		if bus != nil {
+			bus.conn.Close()
+		}
+	}()
 
-	notifier, err := notify.New(sessionConn)
+	notifier, err := newNotifier(&cfg)
 	if err != nil {
 		return err
 	}
 
-	signalChan := make(chan *dbus.Signal, 10)
-	sysConn.Signal(signalChan)
+	m := newMonitor(&cfg, bus.conn, notifier, cfg.devicePaths())
+	defer func() {
+		m.notifier.Close()
+	}()
+	m.readDevices()
+	if cfg.chargeThreshold > 0 {
+		m.setChargeThresholds()
+	}
 
-	err = sysConn.AddMatchSignal(
-		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
-		dbus.WithMatchObjectPath(batteryPath),
-		dbus.WithMatchMember("PropertiesChanged"),
-	)
+	if bus.profilesPath != "" {
+		slog.Info(fmt.Sprintf("Using thresholds for power profile %s", bus.profile))
+		m.cfg = cfg.withProfile(bus.profile)
+	}
+	m.setLocked(bus.locked)
+
+	slog.Info("Listening for changes in battery")
+
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Error(err.Error())
+	}
+
+	watch, err := watchNotificationServer(&cfg)
 	if err != nil {
 		return err
 	}
+	defer watch.Close()
 
-	var lastNotificationID uint32
+	return listen(ctx, &cfg, m, bus, watch)
+}
 
-	slog.Info("Listening for changes in battery")
+// listen handles the signals of bus and watch for m until ctx is done. A
+// notification in flight when ctx is done is sent before it returns. It
+// reconnects bus in place when the system bus goes away.
+func listen(ctx context.Context, cfg *config, m *monitor, bus *systemBus, watch *serverWatch) error {
+	pause := make(chan os.Signal, 1)
+	signal.Notify(pause, syscall.SIGUSR1)
+	defer signal.Stop(pause)
+
+	var reminders <-chan time.Time
+	if cfg.chargeLimit > 0 && cfg.limitRepeat > 0 {
+		ticker := m.clock.NewTicker(cfg.limitRepeat)
+		defer ticker.Stop()
+		reminders = ticker.Chan()
+	}
+
+	var daily <-chan time.Time
+	if cfg.dailySummaryAt != "" {
+		daily = m.clock.After(m.untilDailySummary())
+	}
+
+	var watchdog <-chan time.Time
+	if interval := watchdogInterval(); interval > 0 {
+		ticker := m.clock.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.Chan()
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			slog.Info("Quitting")
 			return nil
-		case signal := <-signalChan:
-			// Handling signal body format
-			if len(signal.Body) < 2 {
-				continue
+		case <-watchdog:
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				slog.Error(err.Error())
 			}
-			properties, ok := signal.Body[1].(map[string]dbus.Variant)
+		case <-reminders:
+			m.remindChargeLimit()
+		case <-pause:
+			m.togglePause()
+		case <-watch.Started():
+			slog.Info("The notification server started, reconnecting to it")
+			m.reopenNotifier(cfg)
+		case <-daily:
+			m.sendDailySummary(ctx)
+			daily = m.clock.After(m.untilDailySummary())
+		case <-bus.handler.overflow:
+			slog.Warn("Signals were dropped, reading the battery state again")
+			m.resync(ctx)
+		case signal, ok := <-bus.signals:
 			if !ok {
-				continue
-			}
+				slog.Warn("Lost connection to the system bus")
+				bus.conn.Close()
 
-			if stateProp, exists := properties["State"]; exists {
-				if state, ok := stateProp.Value().(uint32); ok && state == stateCharging {
-					slog.Info("Closing last notification")
-					_, err := notifier.CloseNotification(lastNotificationID)
-					if err != nil {
-						slog.Error(err.Error())
-					}
+				next, err := reconnectSystemBus(ctx, cfg, m.clock)
+				if err != nil {
+					slog.Info("Quitting")
+					return nil
 				}
-			}
 
-			percentageProp, exists := properties["Percentage"]
-			if !exists {
-				continue
-			}
-			var percentage float64
-			if percentage, ok = percentageProp.Value().(float64); !ok {
+				// run closes the connection of bus when it returns.
+				*bus = *next
+				slog.Info("Reconnected to the system bus")
+				m.sysConn = bus.conn
+				m.cfg = cfg
+				if bus.profilesPath != "" {
+					m.cfg = cfg.withProfile(bus.profile)
+				}
+				m.setLocked(bus.locked)
+				m.readDevices()
+				m.resync(ctx)
 				continue
 			}
 
-			obj := sysConn.Object("org.freedesktop.UPower", signal.Path)
-
-			var state uint32
-			if err := obj.Call(dbusCallPropertiesGet, 0, dbusUPowerDeviceInterface, "State").Store(&state); err != nil {
-				slog.Error(err.Error())
+			// logind signals once before suspending and once again, with
+			// false, after resuming.
+			if signal.Name == login1PrepareForSleep {
+				if len(signal.Body) > 0 && signal.Body[0] == false {
+					slog.Info("Resumed from suspend, reading the battery state again")
+					m.resync(ctx)
+				}
 				continue
 			}
 
-			var model string
-			if err := obj.Call(dbusCallPropertiesGet, 0, dbusUPowerDeviceInterface, "Model").Store(&model); err != nil {
-				slog.Error(err.Error())
+			// Handling signal body format
+			if len(signal.Body) < 2 {
 				continue
 			}
-
-			if state != stateDischarging {
-				slog.Info(fmt.Sprintf("Skipping notification. State: %s", stateMap[state]))
+			properties, ok := signal.Body[1].(map[string]dbus.Variant)
+			if !ok {
 				continue
 			}
 
-			if percentage > thresholdLow {
-				slog.Info(fmt.Sprintf("Skipping notification. Battery level: %.0f%%", percentage))
+			if signal.Path == bus.sessionPath {
+				if locked, ok := properties["LockedHint"].Value().(bool); ok {
+					m.setLocked(locked)
+				}
 				continue
 			}
 
-			notification := notify.Notification{
-				AppName:       appName,
-				ReplacesID:    lastNotificationID,
-				Summary:       fmt.Sprintf("Battery: %s", model),
-				Body:          fmt.Sprintf("󰁹 Current level: %.0f%%", percentage),
-				ExpireTimeout: notify.ExpireTimeoutSetByNotificationServer,
-				Hints: map[string]dbus.Variant{
-					"value": dbus.MakeVariant(int(math.Round(percentage))),
-				},
-			}
-
-			if percentage <= thresholdCritital {
-				notification.ExpireTimeout = notify.ExpireTimeoutNever
-				notification.SetUrgency(notify.UrgencyCritical)
-			} else if percentage <= thresholdLow {
-				notification.SetUrgency(notify.UrgencyLow)
+			if signal.Path == bus.profilesPath {
+				if profile, ok := properties["ActiveProfile"].Value().(string); ok {
+					slog.Info(fmt.Sprintf("Using thresholds for power profile %s", profile))
+					m.cfg = cfg.withProfile(profile)
+				}
+				continue
 			}
 
-			slog.Info("Sending notification")
-			lastNotificationID, err = notifier.SendNotification(notification)
-			if err != nil {
-				slog.Error(err.Error())
-			}
+			m.handleChanges(ctx, signal.Path, properties)
 		}
 	}
 }
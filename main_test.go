@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+// blockingNotifier blocks every send until release is closed, telling on
+// sending when a send starts.
+type blockingNotifier struct {
+	fakeNotifier
+	sending chan struct{}
+	release chan struct{}
+}
+
+func (n *blockingNotifier) SendNotification(notification notify.Notification) (uint32, error) {
+	n.sending <- struct{}{}
+	<-n.release
+	return n.fakeNotifier.SendNotification(notification)
+}
+
+// newTestBus returns a system bus with no connection, whose signals are sent
+// by the test.
+func newTestBus() *systemBus {
+	return &systemBus{handler: newDroppingSignalHandler(), signals: make(chan *dbus.Signal, 1)}
+}
+
+// startListen runs listen for m on bus, returning the channel receiving its
+// result.
+func startListen(ctx context.Context, m *monitor, bus *systemBus) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- listen(ctx, m.cfg, m, bus, nil)
+	}()
+	return done
+}
+
+// waitListen fails t unless listen returns on done within a short deadline.
+func waitListen(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("listen() = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("listen() did not return within a second of the cancellation")
+	}
+}
+
+func TestListenCancel(t *testing.T) {
+	m, _ := newTestMonitor(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	done := startListen(ctx, m, newTestBus())
+
+	cancel()
+	waitListen(t, done)
+}
+
+func TestListenCancelDuringSend(t *testing.T) {
+	m, _ := newTestMonitor(t)
+	notifier := &blockingNotifier{sending: make(chan struct{}, 1), release: make(chan struct{})}
+	m.notifier = notifier
+
+	ctx, cancel := context.WithCancel(t.Context())
+	bus := newTestBus()
+	done := startListen(ctx, m, bus)
+
+	bus.signals <- &dbus.Signal{
+		Path: testDevice,
+		Name: "org.freedesktop.DBus.Properties.PropertiesChanged",
+		Body: []any{dbusUPowerDeviceInterface, batteryProperties(stateDischarging, 5), []string{}},
+	}
+	select {
+	case <-notifier.sending:
+	case <-time.After(time.Second):
+		t.Fatal("no notification sent for the battery at 5%")
+	}
+
+	cancel()
+	// The send in flight is left to finish rather than abandoned.
+	select {
+	case <-done:
+		t.Fatal("listen() returned with a send in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(notifier.release)
+	waitListen(t, done)
+	if n := notifier.sentCount(); n != 1 {
+		t.Errorf("sent %d notifications, want the one in flight", n)
+	}
+}
+
+func TestStateName(t *testing.T) {
+	tests := []struct {
+		state uint32
+		want  string
+	}{
+		{stateUnknown, "Unknown"},
+		{stateDischarging, "Discharging"},
+		{statePendingDischarge, "Pending Discharge"},
+		{7, "Unknown(7)"},
+		{42, "Unknown(42)"},
+	}
+
+	for _, tt := range tests {
+		if got := stateName(tt.state); got != tt.want {
+			t.Errorf("stateName(%d) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
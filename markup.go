@@ -0,0 +1,61 @@
+package main
+
+import (
+	"html"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/esiqveland/notify"
+)
+
+var markupTag = regexp.MustCompile(`<[^>]*>`)
+
+// stripMarkup turns a body written in the markup of the notification
+// specification into plain text.
+func stripMarkup(body string) string {
+	return html.UnescapeString(markupTag.ReplaceAllString(body, ""))
+}
+
+// useMarkup reports whether bodies are sent with markup. The portal takes
+// plain text bodies, whatever the server behind it renders.
+func (c *config) useMarkup() bool {
+	return c.markup && c.backend != "portal" && c.supports("body-markup")
+}
+
+// body returns markup as is when markup is enabled, or else as plain text.
+// Bodies are always written with markup so there is a single version of each.
+func (c *config) body(markup string) string {
+	if c.useMarkup() {
+		return markup
+	}
+	return stripMarkup(markup)
+}
+
+// fitLengths truncates the summary and the body of notification to the
+// maximum lengths, in characters, for servers rejecting or cutting long ones.
+// A body with markup is shortened as plain text, as cutting it could leave an
+// unclosed tag.
+func (c *config) fitLengths(notification *notify.Notification) {
+	notification.Summary = truncate(notification.Summary, c.maxSummaryLength)
+
+	plain := notification.Body
+	if c.useMarkup() {
+		plain = stripMarkup(plain)
+	}
+	if c.maxBodyLength > 0 && utf8.RuneCountInString(plain) > c.maxBodyLength {
+		notification.Body = truncate(plain, c.maxBodyLength)
+		if c.useMarkup() {
+			notification.Body = html.EscapeString(notification.Body)
+		}
+	}
+}
+
+// truncate shortens s to max characters, ending with an ellipsis, unless max
+// is zero.
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if max <= 0 || len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/esiqveland/notify"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"battery", 0, "battery"},
+		{"battery", 6, "batte…"},
+		{"battery", 7, "battery"},
+		{"battery", 8, "battery"},
+		// Lengths count characters, not bytes.
+		{"niveau bas éé", 12, "niveau bas …"},
+		{"niveau bas éé", 13, "niveau bas éé"},
+		{"niveau bas éé", 14, "niveau bas éé"},
+		{"󰁺 10%", 4, "󰁺 1…"},
+		{"󰁺 10%", 5, "󰁺 10%"},
+	}
+
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestFitLengths(t *testing.T) {
+	const body = "Level: <b>10%</b> &amp; falling"
+	// The plain text of body is 20 characters long.
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--max-body-length", "19"}, "Level: 10% &amp; falli…"},
+		{[]string{"--max-body-length", "20"}, body},
+		{[]string{"--max-body-length", "21"}, body},
+		{[]string{"--markup=false", "--max-body-length", "19"}, "Level: <b>10%</b> …"},
+		// Without markup, the tags count as text.
+		{[]string{"--markup=false", "--max-body-length", "30"}, "Level: <b>10%</b> &amp; falli…"},
+		{[]string{"--markup=false", "--max-body-length", "31"}, body},
+		{[]string{"--markup=false", "--max-body-length", "32"}, body},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, append([]string{"--markup"}, tt.args...)...)
+		notification := notify.Notification{Summary: "Battery", Body: body}
+		cfg.fitLengths(&notification)
+		if notification.Body != tt.want {
+			t.Errorf("body with %q = %q, want %q", tt.args, notification.Body, tt.want)
+		}
+	}
+}
+
+func TestPortalBody(t *testing.T) {
+	cfg := newTestConfig(t, "--markup", "--backend", "portal")
+	if got := cfg.body("Level: <b>10%</b> &amp; falling"); got != "Level: 10% & falling" {
+		t.Errorf("body through the portal = %q, want plain text", got)
+	}
+}
+
+func TestFitSummaryLength(t *testing.T) {
+	tests := []struct {
+		max  int
+		want string
+	}{
+		{9, "Batterie…"},
+		{10, "Batterie é"},
+		{11, "Batterie é"},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, "--max-summary-length", strconv.Itoa(tt.max))
+		notification := notify.Notification{Summary: "Batterie é"}
+		cfg.fitLengths(&notification)
+		if notification.Summary != tt.want {
+			t.Errorf("summary with --max-summary-length %d = %q, want %q", tt.max, notification.Summary, tt.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// messages holds the user-facing strings, which can be translated with a
+// messages file per locale.
+type messages struct {
+	currentLevel   string
+	fullyCharged   string
+	batteryRemoved string
+	charger        string
+	drain          string
+	limit          string
+	dailySummary   string
+	health         string
+	lowWarnings    string
+	lowBatteries   string
+	allBatteries   string
+	low            string
+	timeLeft       string
+	timeToFull     string
+	chargeRate     string
+
+	// The labels and grades of the health command.
+	healthLevel      string
+	healthState      string
+	healthCapacity   string
+	healthOfDesign   string
+	healthEnergyFull string
+	healthEnergy     string
+	healthCycles     string
+	healthGrade      string
+	healthGood       string
+	healthFair       string
+	healthPoor       string
+
+	states  map[uint32]string
+	devices map[uint32]string
+}
+
+// registerFlags binds the strings of m to flags in fs, which are the keys of
+// the messages files. States and device types are keyed by their English
+// name, e.g. state-fully-charged or device-mouse.
+func (m *messages) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&m.currentLevel, "current-level", "Current level", "")
+	fs.StringVar(&m.fullyCharged, "fully-charged", "Fully charged", "")
+	fs.StringVar(&m.batteryRemoved, "battery-removed", "Battery removed", "")
+	fs.StringVar(&m.charger, "charger", "On AC but discharging, the charger may be insufficient", "")
+	fs.StringVar(&m.drain, "drain", "Battery draining fast", "")
+	fs.StringVar(&m.limit, "limit", "Charged past the limit, unplug the charger", "")
+	fs.StringVar(&m.dailySummary, "daily-summary", "Battery summary", "")
+	fs.StringVar(&m.health, "health", "health %.0f%%", "")
+	fs.StringVar(&m.lowWarnings, "low-warnings", "Low warnings today: %d", "")
+	fs.StringVar(&m.lowBatteries, "low-batteries", "Low batteries", "")
+	fs.StringVar(&m.allBatteries, "all-batteries", "All batteries", "")
+	fs.StringVar(&m.low, "low", "Low", "")
+	fs.StringVar(&m.timeLeft, "time-left", "%s left", "")
+	fs.StringVar(&m.timeToFull, "time-to-full", "full in %s", "")
+	fs.StringVar(&m.chargeRate, "charge-rate", "charging at %.0f W", "")
+	fs.StringVar(&m.healthLevel, "health-level", "Level", "")
+	fs.StringVar(&m.healthState, "health-state", "State", "")
+	fs.StringVar(&m.healthCapacity, "health-capacity", "Capacity", "")
+	fs.StringVar(&m.healthOfDesign, "health-of-design", "%.0f%% of design", "")
+	fs.StringVar(&m.healthEnergyFull, "health-energy-full", "Energy full", "")
+	fs.StringVar(&m.healthEnergy, "health-energy", "%.1f Wh of %.1f Wh", "")
+	fs.StringVar(&m.healthCycles, "health-cycles", "Cycles", "")
+	fs.StringVar(&m.healthGrade, "health-grade", "Health", "")
+	fs.StringVar(&m.healthGood, "health-good", "Good", "")
+	fs.StringVar(&m.healthFair, "health-fair", "Fair", "")
+	fs.StringVar(&m.healthPoor, "health-poor", "Poor", "")
+
+	m.states = map[uint32]string{}
+	for state, name := range stateMap {
+		m.states[state] = name
+		fs.Func(messageKey("state", name), "", func(s string) error {
+			m.states[state] = s
+			return nil
+		})
+	}
+
+	m.devices = map[uint32]string{deviceTypeBattery: deviceLabel(deviceTypeBattery)}
+	for deviceType, label := range deviceLabels {
+		m.devices[deviceType] = label
+	}
+	for deviceType, label := range m.devices {
+		fs.Func(messageKey("device", label), "", func(s string) error {
+			m.devices[deviceType] = s
+			return nil
+		})
+	}
+}
+
+// messageKey returns the key of an English name, e.g. state-pending-charge.
+func messageKey(prefix, name string) string {
+	return prefix + "-" + strings.ReplaceAll(strings.ToLower(name), " ", "-")
+}
+
+// state returns the label of state, falling back to its name for states
+// without a label.
+func (m *messages) state(state uint32) string {
+	if label, ok := m.states[state]; ok {
+		return label
+	}
+	return stateName(state)
+}
+
+// device names the kind of device, defaulting to the label of batteries.
+func (m *messages) device(deviceType uint32) string {
+	if label, ok := m.devices[deviceType]; ok {
+		return label
+	}
+	return m.devices[deviceTypeBattery]
+}
+
+// loadMessages returns the strings for locale, such as de_DE.UTF-8, read from
+// the messages files of its language and then of its territory, so that de_AT
+// only needs to override what differs from de. Missing files are skipped,
+// leaving English strings.
+func loadMessages(locale string) (messages, error) {
+	var m messages
+	fs := flag.NewFlagSet("messages", flag.ContinueOnError)
+	m.registerFlags(fs)
+
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return m, nil
+	}
+
+	names := []string{locale}
+	if language, _, ok := strings.Cut(locale, "_"); ok {
+		names = []string{language, locale}
+	}
+
+	var paths []string
+	for _, dir := range configDirs() {
+		for _, name := range names {
+			paths = append(paths, filepath.Join(dir, "messages", name+".toml"))
+		}
+	}
+
+	return m, loadConfigFiles(fs, paths)
+}
+
+// messagesLocale returns the locale of messages following POSIX precedence.
+func messagesLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			return locale
+		}
+	}
+	return ""
+}
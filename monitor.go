@@ -0,0 +1,817 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+// monitor turns changes of the battery properties into notifications.
+type monitor struct {
+	cfg      *config
+	sysConn  *dbus.Conn
+	notifier notify.Notifier
+	clock    clock
+
+	devices map[dbus.ObjectPath]*device
+
+	// summaryID is the notification listing every low device when
+	// notifications are consolidated, and summaryHeld whether it is held
+	// back until the screen is unlocked.
+	summaryID   uint32
+	summaryHeld bool
+
+	// paused suppresses every notification while devices are still
+	// tracked, toggled by SIGUSR1.
+	paused bool
+
+	// locked holds back notifications other than critical ones, queued
+	// until the screen is unlocked.
+	locked bool
+	queued []queuedNotification
+
+	// dailyID is the last daily summary, and lowWarnings the number of
+	// times a device ran low since.
+	dailyID     uint32
+	lowWarnings int
+}
+
+// device is the state kept for each monitored UPower device.
+type device struct {
+	path dbus.ObjectPath
+
+	// deviceType and powerSupply describe the device, which may be a
+	// wireless peripheral rather than a laptop battery.
+	deviceType  uint32
+	powerSupply bool
+
+	// nativePath names the device in sysfs, e.g. BAT0.
+	nativePath string
+
+	// Removable batteries report garbage while absent, so whether the
+	// battery is present is cached and kept up to date from the signals.
+	present bool
+
+	// state is the last state seen in the signals, to notice the battery
+	// starting or stopping to discharge.
+	state uint32
+
+	// notificationIDs are the notifications last sent, by the event they
+	// are tracked under. An ID of 0 or none means no notification has been
+	// sent since startup or since the last one was closed.
+	notificationIDs map[event]uint32
+	contentHashes   map[event]uint64
+	lowReadings     int
+	panicked        bool
+	hookKey         string
+	stopBeep        context.CancelFunc
+	idleLock        *os.File
+	rates           rateWindow
+	drain           drainWindow
+	drained         bool
+
+	// step is the last step of --notify-every reached by d, once stepped
+	// tells it was read during this discharge.
+	step    int
+	stepped bool
+
+	// overLimit tells that d is charging past the charge limit, last read
+	// at limitLevel with timeToFull left, charging at chargeRate.
+	overLimit  bool
+	limitLevel float64
+	limitModel string
+	timeToFull time.Duration
+	chargeRate float64
+
+	// notified is the last low or critical event notified for d, at
+	// notifiedAt, a zero time until one is during this discharge.
+	notified   event
+	notifiedAt time.Time
+
+	// skipLogged and skipLevel track the last skipped notification logged,
+	// to keep repeated skips out of the info logs.
+	skipLogged bool
+	skipLevel  float64
+
+	// model, lowLevel and lowEvent describe the device in the consolidated
+	// notification while it is low.
+	model    string
+	low      bool
+	lowLevel float64
+	lowEvent event
+}
+
+// newMonitor returns a monitor for the devices at paths.
+func newMonitor(cfg *config, sysConn *dbus.Conn, notifier notify.Notifier, paths []dbus.ObjectPath) *monitor {
+	m := &monitor{
+		cfg:      cfg,
+		sysConn:  sysConn,
+		notifier: notifier,
+		clock:    systemClock{},
+		devices:  map[dbus.ObjectPath]*device{},
+	}
+	for _, path := range paths {
+		m.devices[path] = &device{
+			path:            path,
+			deviceType:      deviceTypeBattery,
+			powerSupply:     true,
+			present:         true,
+			notificationIDs: map[event]uint32{},
+			contentHashes:   map[event]uint64{},
+			nativePath:      strings.TrimPrefix(filepath.Base(string(path)), "battery_"),
+			rates:           rateWindow{size: cfg.rateWindow},
+			drain:           drainWindow{window: cfg.drainWindow},
+		}
+	}
+	return m
+}
+
+// readDevices reads the properties of the devices that rarely change. Errors
+// are logged, leaving defaults fitting a laptop battery.
+func (m *monitor) readDevices() {
+	for path, d := range m.devices {
+		obj := m.sysConn.Object(dbusUPowerService, path)
+		for name, v := range map[string]any{
+			"Type":        &d.deviceType,
+			"PowerSupply": &d.powerSupply,
+			"IsPresent":   &d.present,
+			"NativePath":  &d.nativePath,
+		} {
+			if err := deviceProperty(obj, nil, name, v); err != nil {
+				slog.Error(err.Error())
+			}
+		}
+	}
+}
+
+// setChargeThresholds programs the charge stop threshold of the batteries, as
+// asked with --charge-threshold-set. Errors are logged, as most laptops do not
+// support it.
+func (m *monitor) setChargeThresholds() {
+	for _, d := range m.devices {
+		if d.deviceType != deviceTypeBattery {
+			continue
+		}
+		if err := writeChargeThreshold(d.nativePath, m.cfg.chargeThreshold); err != nil {
+			slog.Error(err.Error())
+			continue
+		}
+		slog.Info(fmt.Sprintf("Set the charge threshold of %s to %d%%", d.nativePath, m.cfg.chargeThreshold))
+	}
+}
+
+// resync reads the properties of every device from the bus and handles them
+// as if they had all changed, after signals may have been missed.
+func (m *monitor) resync(ctx context.Context) {
+	for path := range m.devices {
+		properties, err := deviceProperties(m.sysConn, path)
+		if err != nil {
+			slog.Error(err.Error())
+			continue
+		}
+
+		m.handleChanges(ctx, path, properties)
+	}
+}
+
+// send sends notification for ev about d, at percentage and in state,
+// replacing the last one sent for it, or for the same event with the
+// per-event policy. It reports whether the notification is shown, which it is
+// not while paused or held back.
+func (m *monitor) send(d *device, ev event, notification notify.Notification, percentage float64, state uint32) (bool, error) {
+	if m.paused {
+		slog.Info("Skipping notification. Paused")
+		return false, nil
+	}
+
+	if m.holdBack(d, ev, notification, percentage, state) {
+		slog.Info("Holding back notification. Screen locked")
+		return false, nil
+	}
+
+	key := m.notificationKey(ev)
+	notification.ReplacesID = d.notificationIDs[key]
+
+	// Replacing a notification by an identical one only makes it flicker.
+	hash := contentHash(notification)
+	if notification.ReplacesID != 0 && d.contentHashes[key] == hash {
+		slog.Debug("Skipping notification. Content unchanged")
+		return true, nil
+	}
+
+	slog.Info("Sending notification")
+	id, err := m.notifier.SendNotification(notification)
+	if err != nil {
+		return false, err
+	}
+
+	d.notificationIDs[key] = id
+	d.contentHashes[key] = hash
+	d.skipLogged = false
+	m.recordHistory(ev, notification, percentage, state)
+	return true, nil
+}
+
+// recordHistory appends notification, just sent for ev while the battery was
+// at percentage and in state, to the history file when there is one.
+func (m *monitor) recordHistory(ev event, notification notify.Notification, percentage float64, state uint32) {
+	if m.cfg.historyFile == "" {
+		return
+	}
+	entry := newHistoryEntry(m.clock.Now(), ev, notification, percentage, state)
+	if err := appendHistory(m.cfg.historyFile, entry); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// contentHash returns a hash of what notification shows.
+func contentHash(notification notify.Notification) uint64 {
+	h := fnv.New64a()
+	urgency, _ := notification.Hints["urgency"].Value().(byte)
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%d", notification.Summary, notification.Body, notification.AppIcon, urgency)
+	return h.Sum64()
+}
+
+// reopenNotifier replaces the notifier by one talking to the notification
+// server that just started. The notifications sent to the previous server are
+// gone with it, so their IDs are forgotten and low levels notified again.
+func (m *monitor) reopenNotifier(cfg *config) {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	m.notifier.Close()
+	m.notifier = notifier
+	m.cfg.capabilities = cfg.capabilities
+
+	for _, d := range m.devices {
+		clear(d.notificationIDs)
+		clear(d.contentHashes)
+		d.notifiedAt = time.Time{}
+	}
+	m.summaryID = 0
+	m.dailyID = 0
+}
+
+// togglePause pauses or resumes notifications.
+func (m *monitor) togglePause() {
+	m.paused = !m.paused
+	if m.paused {
+		slog.Info("Pausing notifications")
+	} else {
+		slog.Info("Resuming notifications")
+	}
+}
+
+// notificationKey returns the event under which the notification sent for ev
+// is tracked. Every event replaces a single notification, tracked under
+// eventLow, unless the per-event policy keeps one per event.
+func (m *monitor) notificationKey(ev event) event {
+	if m.cfg.notifyPolicy == "per-event" {
+		return ev
+	}
+	return eventLow
+}
+
+// logSkip logs why no notification is sent for d at percentage. Signals keep
+// coming while on AC, so skips are logged at debug level until the level has
+// moved by the log delta since the last one logged at info level.
+func (m *monitor) logSkip(d *device, percentage float64, reason string) {
+	message := "Skipping notification. " + reason
+	if d.skipLogged && math.Abs(percentage-d.skipLevel) < m.cfg.logDelta {
+		slog.Debug(message)
+		return
+	}
+
+	d.skipLogged, d.skipLevel = true, percentage
+	slog.Info(message)
+}
+
+// journal records ev in the journal when asked to, whether or not notification
+// could be shown, as it may be the only record on headless machines.
+func (m *monitor) journal(ev event, notification notify.Notification, percentage float64, state uint32) {
+	if !m.cfg.journalEvents {
+		return
+	}
+	if err := journalEvent(ev, newHistoryEntry(m.clock.Now(), ev, notification, percentage, state)); err != nil {
+		slog.Error(err.Error())
+	}
+}
+
+// resetCrossings forgets which thresholds and drops d was notified about, on
+// switching between charging and discharging.
+func (m *monitor) resetCrossings(d *device) {
+	d.lowReadings = 0
+	d.notifiedAt = time.Time{}
+	clear(d.contentHashes)
+	d.hookKey = ""
+	d.panicked = false
+	d.drained = false
+	d.drain.reset()
+	d.stepped = false
+	d.rates.reset()
+}
+
+// recovered resets the low battery tracking of d once its level is fine.
+func (m *monitor) recovered(d *device) {
+	d.lowReadings = 0
+	d.notifiedAt = time.Time{}
+	clear(d.contentHashes)
+	m.stopBeep(d)
+	m.releaseIdle(d)
+	if d.low {
+		d.low = false
+		m.updateSummary()
+	}
+}
+
+// updateSummary sends, replaces or closes the consolidated notification
+// listing every low device. It reports whether the notification is shown,
+// which it is not while paused or held back, marking the devices listed as
+// notified when it is.
+func (m *monitor) updateSummary() bool {
+	var low []*device
+	for _, d := range m.devices {
+		if d.low {
+			low = append(low, d)
+		}
+	}
+
+	if len(low) == 0 {
+		m.summaryHeld = false
+		if m.summaryID != 0 {
+			slog.Info("Closing summary notification")
+			if _, err := m.notifier.CloseNotification(m.summaryID); err != nil {
+				slog.Error(err.Error())
+			}
+			m.summaryID = 0
+		}
+		return false
+	}
+
+	slices.SortFunc(low, func(a, b *device) int { return strings.Compare(string(a.path), string(b.path)) })
+
+	lowest := low[0]
+	entries := make([]string, 0, len(low))
+	for _, d := range low {
+		entries = append(entries, fmt.Sprintf("%s <b>%s</b>", html.EscapeString(d.model), m.cfg.formatPercentage(d.lowLevel)))
+		if d.lowLevel < lowest.lowLevel {
+			lowest = d
+		}
+	}
+
+	ev, _ := m.cfg.classify(lowest.lowLevel, 0)
+	notification := m.cfg.newNotification(ev, lowest.deviceType, lowest.model, lowest.lowLevel, 0)
+	notification.Summary = m.cfg.msgs.lowBatteries
+	notification.Body = m.cfg.body(html.EscapeString(m.cfg.msgs.low) + ": " + strings.Join(entries, ", "))
+	notification.ReplacesID = m.summaryID
+	m.cfg.fitLengths(&notification)
+
+	if m.paused {
+		slog.Info("Skipping summary notification. Paused")
+		return false
+	}
+
+	// The summary is built afresh on unlocking, so only the need to send it
+	// is held back.
+	if urgency, _ := notification.Hints["urgency"].Value().(byte); m.locked && notify.Urgency(urgency) != notify.UrgencyCritical {
+		slog.Info("Holding back summary notification. Screen locked")
+		m.summaryHeld = true
+		return false
+	}
+
+	slog.Info("Sending summary notification")
+	id, err := m.notifier.SendNotification(notification)
+	if err != nil {
+		slog.Error(err.Error())
+		return false
+	}
+	m.summaryID = id
+	m.summaryHeld = false
+	m.recordHistory(ev, notification, lowest.lowLevel, stateDischarging)
+
+	now := m.clock.Now()
+	for _, d := range low {
+		d.notified, d.notifiedAt = d.lowEvent, now
+	}
+	return true
+}
+
+// checkCharger notifies when d starts discharging, after being in previous
+// state, while line power is online, which happens when the charger cannot
+// keep up with the load.
+func (m *monitor) checkCharger(ctx context.Context, d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, previous uint32) {
+	state, ok := properties["State"].Value().(uint32)
+	if !ok {
+		return
+	}
+	if state != stateDischarging || previous == stateDischarging {
+		return
+	}
+
+	online, err := linePowerOnline(m.sysConn)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+	if !online {
+		return
+	}
+
+	var model string
+	if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+		slog.Error(err.Error())
+	}
+
+	slog.Info("Discharging while on AC")
+	var percentage float64
+	if err := deviceProperty(obj, properties, "Percentage", &percentage); err != nil {
+		slog.Error(err.Error())
+	}
+
+	percentage = m.cfg.calibrate(percentage)
+
+	notification := m.cfg.newNotification(eventCharger, d.deviceType, m.cfg.modelName(path, model), 0, 0)
+	if _, err := m.send(d, eventCharger, notification, percentage, state); err != nil {
+		slog.Error(err.Error())
+	}
+	m.journal(eventCharger, notification, percentage, state)
+	runHooks(ctx, m.cfg.hooks, eventCharger, percentage, state)
+}
+
+// checkFull runs the hooks of the full event, and notifies with --notify-full,
+// when d finishes charging, after being in previous state.
+func (m *monitor) checkFull(ctx context.Context, d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, previous uint32) {
+	if d.state != stateFullyCharged || (previous != stateCharging && previous != statePendingCharge) {
+		return
+	}
+
+	// The level rarely changes along with the state, and sysfs leaves it
+	// out of the properties when it did not.
+	percentage := 100.0
+	if level, ok := properties["Percentage"].Value().(float64); ok {
+		percentage = m.cfg.calibrate(level)
+	}
+
+	slog.Info("Battery fully charged")
+	if m.cfg.notifyFull {
+		var model string
+		if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+			slog.Error(err.Error())
+		}
+
+		notification := m.cfg.newNotification(eventFull, d.deviceType, m.cfg.modelName(path, model), percentage, 0)
+		if _, err := m.send(d, eventFull, notification, percentage, stateFullyCharged); err != nil {
+			slog.Error(err.Error())
+		}
+		m.journal(eventFull, notification, percentage, stateFullyCharged)
+	}
+	runHooks(ctx, m.cfg.hooks, eventFull, percentage, stateFullyCharged)
+}
+
+// timeLeft returns the time until d is empty. With a rate window the estimate
+// is averaged from the discharge rates seen in the signals, which must then be
+// sampled on every change rather than only once the level is low.
+func (m *monitor) timeLeft(d *device, obj dbus.BusObject, properties map[string]dbus.Variant) (time.Duration, error) {
+	if m.cfg.rateWindow == 0 {
+		var timeToEmpty int64
+		if m.cfg.usesTime() {
+			if err := deviceProperty(obj, properties, "TimeToEmpty", &timeToEmpty); err != nil {
+				return 0, err
+			}
+		}
+		return time.Duration(timeToEmpty) * time.Second, nil
+	}
+
+	var state uint32
+	if err := deviceProperty(obj, properties, "State", &state); err != nil {
+		return 0, err
+	}
+	if state != stateDischarging {
+		d.rates.reset()
+		return 0, nil
+	}
+
+	var rate, energy float64
+	if err := deviceProperty(obj, properties, "EnergyRate", &rate); err != nil {
+		return 0, err
+	}
+	if err := deviceProperty(obj, properties, "Energy", &energy); err != nil {
+		return 0, err
+	}
+	d.rates.add(rate)
+
+	return d.rates.timeLeft(energy), nil
+}
+
+// notifyLow sends the notification for ev, a low or critical level of d, or
+// updates the consolidated one. It reports whether d counts as notified: its
+// notification, or the consolidated one listing it, is shown.
+func (m *monitor) notifyLow(d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, ev event, percentage float64, timeLeft time.Duration, state uint32) bool {
+	var model string
+	if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+		slog.Error(err.Error())
+		return false
+	}
+	model = m.cfg.modelName(path, model)
+
+	if m.cfg.consolidate {
+		d.model, d.low, d.lowLevel, d.lowEvent = model, true, percentage, ev
+		return m.updateSummary()
+	}
+
+	notification := m.cfg.newNotification(ev, d.deviceType, model, percentage, timeLeft)
+	if _, ok := m.cfg.eventUrgency(ev); !ok && m.cfg.timeCritical(timeLeft) {
+		notification.SetUrgency(notify.UrgencyCritical)
+	}
+
+	sent, err := m.send(d, ev, notification, percentage, state)
+	if err != nil {
+		slog.Error(err.Error())
+	}
+	m.journal(ev, notification, percentage, state)
+	return sent
+}
+
+// deviceState reads the state of d from properties or, when it did not change,
+// from UPower.
+func (m *monitor) deviceState(ctx context.Context, d *device, obj dbus.BusObject, properties map[string]dbus.Variant) (uint32, error) {
+	var state uint32
+	if err := retryProperty(ctx, m.clock, obj, properties, "State", &state); err != nil {
+		return 0, err
+	}
+
+	// Peripherals often cannot tell whether they are charging, and only
+	// ever run on their battery when they report no state.
+	if state == stateUnknown && !d.powerSupply {
+		state = stateDischarging
+	}
+	return state, nil
+}
+
+// handleChanges reacts to the properties of the device at path changing to
+// the values in properties.
+func (m *monitor) handleChanges(ctx context.Context, path dbus.ObjectPath, properties map[string]dbus.Variant) {
+	d, ok := m.devices[path]
+	if !ok {
+		return
+	}
+
+	previous := d.state
+	if stateProp, exists := properties["State"]; exists {
+		if state, ok := stateProp.Value().(uint32); ok {
+			d.state = state
+			// Levels may jump around plugging and unplugging, so whatever
+			// was crossed before is evaluated afresh.
+			if (state == stateDischarging) != (previous == stateDischarging) {
+				m.resetCrossings(d)
+			}
+		}
+
+		if state, ok := stateProp.Value().(uint32); ok && m.cfg.closeStates[state] {
+			m.dropHeldBack(d)
+			for key, id := range d.notificationIDs {
+				slog.Info("Closing last notification")
+				if _, err := m.notifier.CloseNotification(id); err != nil {
+					slog.Error(err.Error())
+				}
+				delete(d.notificationIDs, key)
+				delete(d.contentHashes, key)
+			}
+		}
+
+		// Unplugging rarely changes the level, so the charge limit warning
+		// is closed here rather than once the level is read.
+		if state, ok := stateProp.Value().(uint32); ok && state != stateCharging && d.overLimit {
+			d.overLimit = false
+			m.closeChargeLimit(d)
+		}
+	}
+
+	obj := m.sysConn.Object(dbusUPowerService, path)
+
+	if presentProp, exists := properties["IsPresent"]; exists {
+		if isPresent, ok := presentProp.Value().(bool); ok && isPresent != d.present {
+			d.present = isPresent
+			if d.present {
+				slog.Info("Battery inserted")
+			} else {
+				slog.Info("Battery removed")
+				m.recovered(d)
+				if m.cfg.notifyRemoved {
+					var model string
+					if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+						slog.Error(err.Error())
+					}
+
+					model = m.cfg.modelName(path, model)
+					notification := m.cfg.newNotification(eventRemoved, d.deviceType, model, 0, 0)
+					if _, err := m.send(d, eventRemoved, notification, 0, stateUnknown); err != nil {
+						slog.Error(err.Error())
+					}
+					m.journal(eventRemoved, notification, 0, stateUnknown)
+				}
+				runHooks(ctx, m.cfg.hooks, eventRemoved, 0, stateUnknown)
+			}
+		}
+	}
+
+	if !d.present {
+		return
+	}
+
+	if m.cfg.notifyCharger {
+		m.checkCharger(ctx, d, obj, path, properties, previous)
+	}
+
+	m.checkFull(ctx, d, obj, path, properties, previous)
+
+	// Only a new level may call for a notification, or a new warning level
+	// when following the one of UPower.
+	_, levelChanged := properties["Percentage"]
+	_, warningChanged := properties["WarningLevel"]
+	if !levelChanged && !(m.cfg.useWarningLevel && warningChanged) {
+		return
+	}
+	var percentage float64
+	if err := deviceProperty(obj, properties, "Percentage", &percentage); err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	// UPower still tells when the level changes, but the level itself may
+	// be read from the kernel.
+	if m.cfg.source == "sysfs" {
+		capacity, err := readCapacity(d.nativePath)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		percentage = capacity
+	}
+
+	if m.cfg.fullEnergy > 0 {
+		var energy float64
+		if err := deviceProperty(obj, properties, "Energy", &energy); err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		percentage = energy / m.cfg.fullEnergy * 100
+	}
+
+	percentage = m.cfg.calibrate(percentage)
+
+	timeLeft, err := m.timeLeft(d, obj, properties)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	if m.cfg.chargeLimit > 0 {
+		m.checkChargeLimit(ctx, d, obj, path, properties, percentage)
+	}
+
+	if m.cfg.notifyEvery > 0 {
+		m.checkStep(ctx, d, obj, path, properties, percentage, timeLeft)
+	}
+
+	if m.cfg.fifo != "" {
+		m.writeStatus(ctx, d, obj, path, properties, percentage, timeLeft)
+	}
+
+	if m.cfg.drainDrop > 0 {
+		m.checkDrain(ctx, d, obj, path, properties, percentage, timeLeft)
+	}
+
+	// Cheap checks go first so that no further D-Bus round-trips are made
+	// for signals that will never produce a notification.
+	ev, ok := m.cfg.policy().hold(percentage, timeLeft, d.notified, !d.notifiedAt.IsZero())
+	if m.cfg.useWarningLevel {
+		var level uint32
+		if err := deviceProperty(obj, properties, "WarningLevel", &level); err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		ev, ok = classifyWarningLevel(level)
+	}
+	// The panic level is a percentage, reached even when time thresholds
+	// give no event as the time left is unknown.
+	panicDue := m.cfg.panicExec != "" && !d.panicked && percentage <= m.cfg.panicThreshold
+	if !ok && !panicDue {
+		m.recovered(d)
+		d.hookKey = ""
+		m.logSkip(d, percentage, fmt.Sprintf("Battery level: %.0f%%", percentage))
+		return
+	}
+
+	state, err := m.deviceState(ctx, d, obj, properties)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	if !ok {
+		m.recovered(d)
+		d.hookKey = ""
+		if state == stateDischarging {
+			m.runPanic(ctx, d, percentage, state)
+		}
+		m.logSkip(d, percentage, fmt.Sprintf("Battery level: %.0f%%", percentage))
+		return
+	}
+
+	// Hooks may ask for a low level while charging, so they run before
+	// discharging is checked, once per event and state.
+	if key := fmt.Sprintf("%s:%d", ev, state); key != d.hookKey {
+		d.hookKey = key
+		runHooks(ctx, m.cfg.hooks, ev, percentage, state)
+	}
+
+	if state != stateDischarging {
+		m.recovered(d)
+		d.panicked = false
+		m.logSkip(d, percentage, fmt.Sprintf("State: %s", stateName(state)))
+		return
+	}
+
+	// On systems with several batteries one of them may discharge into the
+	// other while on AC.
+	if m.cfg.suppressOnAC {
+		online, err := linePowerOnline(m.sysConn)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+		if online {
+			m.recovered(d)
+			d.panicked = false
+			m.logSkip(d, percentage, "On AC power")
+			return
+		}
+	}
+
+	// Require several readings in a row before trusting a low level, to
+	// ignore spurious values from flaky firmware.
+	d.lowReadings++
+	if d.lowReadings < m.cfg.confirmReadings {
+		slog.Info(fmt.Sprintf("Skipping notification. Low reading %d of %d", d.lowReadings, m.cfg.confirmReadings))
+		return
+	}
+	if d.lowReadings == max(m.cfg.confirmReadings, 1) {
+		m.lowWarnings++
+	}
+
+	// With the edge trigger, a notification is only sent on crossing into
+	// a new event, and then again every repeat interval.
+	now := m.clock.Now()
+	if m.cfg.policy().due(ev, d.notified, d.notifiedAt, now) {
+		if ev == d.notified && !d.notifiedAt.IsZero() {
+			delete(d.contentHashes, m.notificationKey(ev))
+		}
+		// A notification that failed, or waits for the screen to be
+		// unlocked, is tried again on the next reading.
+		if m.notifyLow(d, obj, path, properties, ev, percentage, timeLeft, state) {
+			d.notified, d.notifiedAt = ev, now
+		}
+	} else {
+		m.logSkip(d, percentage, fmt.Sprintf("Already notified: %s", ev))
+	}
+
+	if m.cfg.beepCritical && ev == eventCritical {
+		m.startBeep(ctx, d)
+	} else {
+		m.stopBeep(d)
+	}
+
+	if m.cfg.inhibitIdle && ev == eventCritical {
+		m.inhibitIdle(d)
+	} else {
+		m.releaseIdle(d)
+	}
+
+	// The panic hook runs after the notification so the user is warned even
+	// if the hook is slow.
+	if panicDue {
+		m.runPanic(ctx, d, percentage, state)
+	}
+}
+
+// runPanic runs the panic hook for d at percentage, once per discharge cycle.
+func (m *monitor) runPanic(ctx context.Context, d *device, percentage float64, state uint32) {
+	d.panicked = true
+	slog.Info("Running panic hook")
+	if err := runHook(ctx, m.cfg.panicExec, "panic", percentage, state); err != nil {
+		slog.Error(err.Error())
+	}
+}
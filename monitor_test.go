@@ -0,0 +1,455 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+const testDevice = dbus.ObjectPath(devicesPath + "battery_BAT0")
+
+// fakeNotifier records the notifications sent and closed, handing out IDs
+// from 1 and keeping the ID of replaced notifications.
+type fakeNotifier struct {
+	mu     sync.Mutex
+	sent   []notify.Notification
+	closed []uint32
+	lastID uint32
+
+	// err is returned by every send when set.
+	err          error
+	capabilities []string
+}
+
+func (n *fakeNotifier) SendNotification(notification notify.Notification) (uint32, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.err != nil {
+		return 0, n.err
+	}
+	n.sent = append(n.sent, notification)
+	if notification.ReplacesID != 0 {
+		return notification.ReplacesID, nil
+	}
+	n.lastID++
+	return n.lastID, nil
+}
+
+func (n *fakeNotifier) CloseNotification(id uint32) (bool, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.closed = append(n.closed, id)
+	return true, nil
+}
+
+func (n *fakeNotifier) GetCapabilities() ([]string, error) {
+	return n.capabilities, nil
+}
+
+func (n *fakeNotifier) GetServerInformation() (notify.ServerInformation, error) {
+	return notify.ServerInformation{Name: "fake"}, nil
+}
+
+func (n *fakeNotifier) Close() error {
+	return nil
+}
+
+// sentCount returns the number of notifications sent so far.
+func (n *fakeNotifier) sentCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.sent)
+}
+
+// newTestConfig returns the config set by the flags in args, with English
+// messages.
+func newTestConfig(t testing.TB, args ...string) *config {
+	t.Helper()
+
+	var cfg config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.registerFlags(fs)
+	if err := fs.Parse(append([]string{"--device", "battery_BAT0"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := loadMessages("C")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.msgs = msgs
+	return &cfg
+}
+
+// newTestMonitor returns a monitor of testDevice set by the flags in args,
+// notifying on a fake notifier. It has no system bus, so the signals handled
+// must carry every property read.
+func newTestMonitor(t testing.TB, args ...string) (*monitor, *fakeNotifier) {
+	t.Helper()
+
+	notifier := &fakeNotifier{}
+	m := newMonitor(newTestConfig(t, args...), nil, notifier, []dbus.ObjectPath{testDevice})
+	return m, notifier
+}
+
+// batteryProperties returns the properties of testDevice in state at
+// percentage, with every property read by default.
+func batteryProperties(state uint32, percentage float64) map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"Model":       dbus.MakeVariant("Test"),
+		"State":       dbus.MakeVariant(state),
+		"Percentage":  dbus.MakeVariant(percentage),
+		"TimeToEmpty": dbus.MakeVariant(int64(0)),
+	}
+}
+
+// stateProperties returns the properties of a signal only changing the state.
+func stateProperties(state uint32) map[string]dbus.Variant {
+	return map[string]dbus.Variant{"State": dbus.MakeVariant(state)}
+}
+
+func TestCloseOnlySentNotifications(t *testing.T) {
+	m, notifier := newTestMonitor(t)
+
+	for _, state := range []uint32{stateCharging, stateFullyCharged, statePendingCharge} {
+		m.handleChanges(t.Context(), testDevice, stateProperties(state))
+	}
+
+	if len(notifier.closed) != 0 {
+		t.Errorf("closed %v with no notification sent, want none closed", notifier.closed)
+	}
+}
+
+func TestNotifyFull(t *testing.T) {
+	for _, notifyFull := range []bool{false, true} {
+		m, notifier := newTestMonitor(t, fmt.Sprintf("--notify-full=%t", notifyFull))
+
+		m.handleChanges(t.Context(), testDevice, stateProperties(stateCharging))
+		full := stateProperties(stateFullyCharged)
+		full["Model"] = dbus.MakeVariant("Test")
+		m.handleChanges(t.Context(), testDevice, full)
+		// Staying full must not notify again.
+		m.handleChanges(t.Context(), testDevice, full)
+
+		want := 0
+		if notifyFull {
+			want = 1
+		}
+		if len(notifier.sent) != want {
+			t.Fatalf("with --notify-full=%t, sent %d notifications, want %d", notifyFull, len(notifier.sent), want)
+		}
+		if notifyFull && !strings.Contains(notifier.sent[0].Body, "Fully charged") {
+			t.Errorf("body = %q, want it to tell the battery is fully charged", notifier.sent[0].Body)
+		}
+	}
+}
+
+func TestNotificationKey(t *testing.T) {
+	for _, policy := range []string{"replace", "per-event"} {
+		m, _ := newTestMonitor(t, "--notification-policy", policy)
+		for _, ev := range []event{eventLow, eventCritical, eventFull, eventCharger} {
+			want := eventLow
+			if policy == "per-event" {
+				want = ev
+			}
+			if got := m.notificationKey(ev); got != want {
+				t.Errorf("with --notification-policy %s, notificationKey(%s) = %s, want %s", policy, ev, got, want)
+			}
+		}
+	}
+}
+
+func TestNotificationPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		// replaces is the ReplacesID of the low, critical, then low again
+		// notifications.
+		replaces []uint32
+	}{
+		{"replace", []uint32{0, 1, 1}},
+		{"per-event", []uint32{0, 0, 1}},
+	}
+
+	for _, tt := range tests {
+		m, notifier := newTestMonitor(t, "--notification-policy", tt.policy)
+		for _, percentage := range []float64{25, 10, 20} {
+			m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, percentage))
+		}
+
+		if len(notifier.sent) != len(tt.replaces) {
+			t.Fatalf("with --notification-policy %s, sent %d notifications, want %d", tt.policy, len(notifier.sent), len(tt.replaces))
+		}
+		for i, notification := range notifier.sent {
+			if notification.ReplacesID != tt.replaces[i] {
+				t.Errorf("with --notification-policy %s, notification %d replaces %d, want %d", tt.policy, i, notification.ReplacesID, tt.replaces[i])
+			}
+		}
+	}
+}
+
+func TestDefaultTrigger(t *testing.T) {
+	m, notifier := newTestMonitor(t)
+	for _, percentage := range []float64{25, 24, 23, 22} {
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, percentage))
+	}
+	if len(notifier.sent) != 1 {
+		t.Errorf("sent %d notifications for 4 low levels, want 1 on crossing the threshold", len(notifier.sent))
+	}
+
+	m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 15))
+	if len(notifier.sent) != 2 {
+		t.Errorf("sent %d notifications on crossing the critical threshold, want 2", len(notifier.sent))
+	}
+}
+
+// BenchmarkHandleChanges measures the handling of a signal, from the decision
+// to the notification, over batteries draining from full to empty again and
+// again.
+func BenchmarkHandleChanges(b *testing.B) {
+	for _, trigger := range []string{"level", "edge"} {
+		b.Run(trigger, func(b *testing.B) {
+			logger := slog.Default()
+			slog.SetDefault(slog.New(slog.DiscardHandler))
+			b.Cleanup(func() {
+				slog.SetDefault(logger)
+			})
+
+			m, _ := newTestMonitor(b, "--trigger", trigger)
+			m.notifier = &discardNotifier{}
+			var signals []map[string]dbus.Variant
+			for percentage := 100.0; percentage >= 0; percentage -= 0.5 {
+				signals = append(signals, simulatedProperties(m.cfg, percentage))
+			}
+
+			b.ReportAllocs()
+			for i := 0; b.Loop(); i++ {
+				m.handleChanges(b.Context(), testDevice, signals[i%len(signals)])
+			}
+		})
+	}
+}
+
+// discardNotifier is a fakeNotifier keeping no notifications, so that a long
+// benchmark does not grow.
+type discardNotifier struct {
+	fakeNotifier
+}
+
+func (n *discardNotifier) SendNotification(notification notify.Notification) (uint32, error) {
+	if notification.ReplacesID != 0 {
+		return notification.ReplacesID, nil
+	}
+	n.lastID++
+	return n.lastID, nil
+}
+
+func TestSendSkipsUnchanged(t *testing.T) {
+	m, notifier := newTestMonitor(t)
+	d := m.devices[testDevice]
+	notification := m.cfg.newNotification(eventLow, deviceTypeBattery, "Test", 25, 0)
+
+	for range 2 {
+		if _, err := m.send(d, eventLow, notification, 20, stateDischarging); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := notifier.sentCount(); n != 1 {
+		t.Fatalf("sent %d notifications for the same content twice, want 1", n)
+	}
+
+	changed := m.cfg.newNotification(eventLow, deviceTypeBattery, "Test", 24, 0)
+	if _, err := m.send(d, eventLow, changed, 20, stateDischarging); err != nil {
+		t.Fatal(err)
+	}
+	if n := notifier.sentCount(); n != 2 {
+		t.Fatalf("sent %d notifications after the level changed, want 2", n)
+	}
+
+	// After plugging in and out, the same content is news again.
+	m.resetCrossings(d)
+	if _, err := m.send(d, eventLow, changed, 20, stateDischarging); err != nil {
+		t.Fatal(err)
+	}
+	if n := notifier.sentCount(); n != 3 {
+		t.Errorf("sent %d notifications after a state change, want 3", n)
+	}
+}
+
+func TestCloseOnFullyCharged(t *testing.T) {
+	tests := []struct {
+		args  []string
+		state uint32
+		want  []uint32
+	}{
+		{nil, stateFullyCharged, []uint32{1}},
+		{nil, statePendingCharge, []uint32{1}},
+		{[]string{"--close-states", "charging"}, stateFullyCharged, nil},
+		{[]string{"--close-states", "fully-charged"}, stateFullyCharged, []uint32{1}},
+	}
+
+	for _, tt := range tests {
+		m, notifier := newTestMonitor(t, tt.args...)
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+		if len(notifier.sent) != 1 {
+			t.Fatalf("sent %d notifications at 25%%, want 1", len(notifier.sent))
+		}
+
+		// Plugging in near full may skip the charging state.
+		m.handleChanges(t.Context(), testDevice, stateProperties(tt.state))
+		if !slices.Equal(notifier.closed, tt.want) {
+			t.Errorf("with %q, entering %s closed %v, want %v", tt.args, stateName(tt.state), notifier.closed, tt.want)
+		}
+	}
+}
+
+func TestPlugUnplugAroundThreshold(t *testing.T) {
+	tests := []struct {
+		name    string
+		signals []map[string]dbus.Variant
+		want    int
+	}{
+		{
+			"staying low",
+			[]map[string]dbus.Variant{
+				batteryProperties(stateDischarging, 25),
+				batteryProperties(stateDischarging, 24),
+				stateProperties(stateDischarging),
+			},
+			1,
+		},
+		{
+			"unplugged again while low",
+			[]map[string]dbus.Variant{
+				batteryProperties(stateDischarging, 25),
+				batteryProperties(stateCharging, 25),
+				batteryProperties(stateDischarging, 25),
+			},
+			2,
+		},
+		{
+			"level jumping on plugging",
+			[]map[string]dbus.Variant{
+				batteryProperties(stateDischarging, 29),
+				batteryProperties(stateCharging, 32),
+				batteryProperties(stateDischarging, 29),
+				batteryProperties(stateDischarging, 28),
+			},
+			2,
+		},
+		{
+			"plugged in above the threshold",
+			[]map[string]dbus.Variant{
+				batteryProperties(stateDischarging, 31),
+				batteryProperties(stateCharging, 31),
+				batteryProperties(stateDischarging, 31),
+			},
+			0,
+		},
+	}
+
+	for _, tt := range tests {
+		m, notifier := newTestMonitor(t, "--trigger", "edge")
+		for _, properties := range tt.signals {
+			m.handleChanges(t.Context(), testDevice, properties)
+		}
+		if len(notifier.sent) != tt.want {
+			t.Errorf("%s: sent %d notifications, want %d", tt.name, len(notifier.sent), tt.want)
+		}
+	}
+}
+
+func TestNotifiedOnlyWhenShown(t *testing.T) {
+	t.Run("failed", func(t *testing.T) {
+		m, notifier := newTestMonitor(t, "--trigger", "edge")
+		notifier.err = errors.New("server gone")
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+		if d := m.devices[testDevice]; !d.notifiedAt.IsZero() {
+			t.Fatalf("notified at %s after a failed send, want not notified", d.notifiedAt)
+		}
+
+		notifier.err = nil
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 24))
+		if len(notifier.sent) != 1 {
+			t.Errorf("sent %d notifications once the server is back, want 1", len(notifier.sent))
+		}
+	})
+
+	t.Run("paused", func(t *testing.T) {
+		m, notifier := newTestMonitor(t, "--trigger", "edge")
+		m.togglePause()
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+		m.togglePause()
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 24))
+		if len(notifier.sent) != 1 {
+			t.Errorf("sent %d notifications after resuming, want 1", len(notifier.sent))
+		}
+	})
+
+	t.Run("held back", func(t *testing.T) {
+		m, notifier := newTestMonitor(t, "--trigger", "edge")
+		m.setLocked(true)
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+		if len(notifier.sent) != 0 {
+			t.Fatalf("sent %d notifications while locked, want 0", len(notifier.sent))
+		}
+
+		// Unlocking sends the notification held back, which counts.
+		m.setLocked(false)
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 24))
+		if len(notifier.sent) != 1 {
+			t.Errorf("sent %d notifications after unlocking, want the one held back", len(notifier.sent))
+		}
+	})
+}
+
+func TestConsolidatedNotifiedOnlyWhenShown(t *testing.T) {
+	t.Run("paused", func(t *testing.T) {
+		m, notifier := newTestMonitor(t, "--consolidate", "--trigger", "edge")
+		m.togglePause()
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+		if d := m.devices[testDevice]; !d.notifiedAt.IsZero() {
+			t.Fatalf("notified at %s while paused, want not notified", d.notifiedAt)
+		}
+
+		m.togglePause()
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 24))
+		if len(notifier.sent) != 1 {
+			t.Errorf("sent %d notifications after resuming, want 1", len(notifier.sent))
+		}
+	})
+
+	t.Run("held back", func(t *testing.T) {
+		m, notifier := newTestMonitor(t, "--consolidate", "--trigger", "edge")
+		m.setLocked(true)
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 25))
+		if len(notifier.sent) != 0 {
+			t.Fatalf("sent %d notifications while locked, want 0", len(notifier.sent))
+		}
+		if d := m.devices[testDevice]; !d.notifiedAt.IsZero() {
+			t.Fatalf("notified at %s while locked, want not notified", d.notifiedAt)
+		}
+
+		// Unlocking sends the summary held back, which counts.
+		m.setLocked(false)
+		if len(notifier.sent) != 1 || notifier.sent[0].Summary != m.cfg.msgs.lowBatteries {
+			t.Fatalf("sent %v after unlocking, want the summary held back", notifier.sent)
+		}
+		m.handleChanges(t.Context(), testDevice, batteryProperties(stateDischarging, 24))
+		if len(notifier.sent) != 1 {
+			t.Errorf("sent %d notifications after unlocking, want only the summary held back", len(notifier.sent))
+		}
+	})
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log/slog"
+	"maps"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+// event identifies the kind of notification being sent.
+type event int
+
+const (
+	eventLow event = iota
+	eventCritical
+	eventFull
+	eventRemoved
+	eventCharger
+	eventDrain
+	eventLimit
+	eventDaily
+	eventStep
+)
+
+func (ev event) String() string {
+	switch ev {
+	case eventLow:
+		return "low"
+	case eventCritical:
+		return "critical"
+	case eventFull:
+		return "full"
+	case eventRemoved:
+		return "removed"
+	case eventCharger:
+		return "charger"
+	case eventDrain:
+		return "drain"
+	case eventLimit:
+		return "limit"
+	case eventDaily:
+		return "daily"
+	case eventStep:
+		return "step"
+	default:
+		return "unknown"
+	}
+}
+
+// parseEvent returns the event called name.
+func parseEvent(name string) (event, error) {
+	for ev := eventLow; ev <= eventStep; ev++ {
+		if ev.String() == name {
+			return ev, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event %q", name)
+}
+
+// newNotification builds the notification sent for ev. The time left is shown
+// when known, that is when non-zero. Callers are responsible for setting
+// ReplacesID.
+func (c *config) newNotification(ev event, deviceType uint32, model string, percentage float64, timeLeft time.Duration) notify.Notification {
+	notification := notify.Notification{
+		AppName:       appName,
+		Summary:       fmt.Sprintf("%s: %s", c.msgs.device(deviceType), model),
+		Body:          fmt.Sprintf("󰁹 %s: <b>%s</b>", html.EscapeString(c.msgs.currentLevel), c.formatPercentage(percentage)),
+		AppIcon:       c.appIcon,
+		ExpireTimeout: notify.ExpireTimeoutSetByNotificationServer,
+		Hints:         map[string]dbus.Variant{},
+	}
+
+	if !c.noValueHint && c.supports(valueCapabilities...) {
+		notification.Hints["value"] = c.valueHint(percentage)
+	}
+
+	if c.useThemeIcons {
+		notification.AppIcon = iconName(percentage, ev == eventFull)
+	}
+
+	if sound, ok := c.sounds[ev]; ok && c.supports("sound") {
+		notification.AddHint(notify.HintSoundWithName(sound))
+	}
+
+	if c.category != "" {
+		notification.Hints["category"] = dbus.MakeVariant(c.category)
+	}
+
+	// OSDs honoring the hint rarely advertise it, so it is sent whenever
+	// asked for.
+	if c.synchronousTag != "" {
+		notification.Hints["x-canonical-private-synchronous"] = dbus.MakeVariant(c.synchronousTag)
+	}
+
+	switch ev {
+	case eventCritical, eventLow:
+		if timeLeft > 0 {
+			notification.Body += ", " + html.EscapeString(fmt.Sprintf(c.msgs.timeLeft, formatDuration(timeLeft, c.durationFormat)))
+		}
+		if ev == eventCritical {
+			notification.Body = "<b>" + notification.Body + "</b>"
+			notification.ExpireTimeout = notify.ExpireTimeoutNever
+			if c.criticalResident {
+				notification.Hints["resident"] = dbus.MakeVariant(true)
+			}
+		}
+		if urgency, ok := c.urgency(percentage); ok {
+			notification.SetUrgency(urgency)
+		}
+	case eventFull:
+		notification.Body = "󰁹 " + html.EscapeString(c.msgs.fullyCharged)
+		notification.SetUrgency(notify.UrgencyLow)
+	case eventRemoved:
+		notification.Body = "󰂑 " + html.EscapeString(c.msgs.batteryRemoved)
+		delete(notification.Hints, "value")
+		if c.useThemeIcons {
+			notification.AppIcon = "battery-missing-symbolic"
+		}
+		notification.SetUrgency(notify.UrgencyLow)
+	case eventCharger:
+		notification.Body = "󰚥 " + html.EscapeString(c.msgs.charger)
+		delete(notification.Hints, "value")
+		notification.SetUrgency(notify.UrgencyNormal)
+	case eventDrain:
+		notification.Body = fmt.Sprintf("󱈸 %s: <b>%s</b>", html.EscapeString(c.msgs.drain), c.formatPercentage(percentage))
+		if timeLeft > 0 {
+			notification.Body += ", " + html.EscapeString(fmt.Sprintf(c.msgs.timeLeft, formatDuration(timeLeft, c.durationFormat)))
+		}
+		notification.SetUrgency(notify.UrgencyNormal)
+	case eventLimit:
+		notification.Body = fmt.Sprintf("󰂅 %s: <b>%s</b>", html.EscapeString(c.msgs.limit), c.formatPercentage(percentage))
+		if c.showTimeToFull && timeLeft > 0 {
+			notification.Body += ", " + html.EscapeString(fmt.Sprintf(c.msgs.timeToFull, formatDuration(timeLeft, c.durationFormat)))
+		}
+		notification.SetUrgency(notify.UrgencyNormal)
+	case eventDaily:
+		delete(notification.Hints, "value")
+		notification.SetUrgency(notify.UrgencyLow)
+	case eventStep:
+		if timeLeft > 0 {
+			notification.Body += ", " + html.EscapeString(fmt.Sprintf(c.msgs.timeLeft, formatDuration(timeLeft, c.durationFormat)))
+		}
+		notification.SetUrgency(notify.UrgencyLow)
+	}
+
+	if urgency, ok := c.eventUrgency(ev); ok {
+		notification.SetUrgency(urgency)
+	}
+
+	// Collapsed notifications often only show the summary. Removed batteries
+	// and chargers come without a level.
+	if c.percentInSummary && ev != eventRemoved && ev != eventCharger {
+		notification.Summary += " (" + c.formatPercentage(percentage) + ")"
+	}
+
+	notification.Body = c.body(notification.Body)
+	c.fitLengths(&notification)
+
+	c.adjustForDaemon(&notification, percentage)
+
+	// Extra hints go last so that they can override the built-in ones.
+	maps.Copy(notification.Hints, c.hints)
+
+	return notification
+}
+
+// formatPercentage formats a battery level for display, with the number of
+// decimals set by --percentage-precision.
+func (c *config) formatPercentage(percentage float64) string {
+	return strconv.FormatFloat(percentage, 'f', c.percentPrecision, 64) + "%"
+}
+
+// adjustForDaemon changes the hints of notification to the combination known
+// to work with the notification daemon chosen with --daemon-profile.
+func (c *config) adjustForDaemon(notification *notify.Notification, percentage float64) {
+	switch c.daemonProfile {
+	case "kde":
+		// Plasma only fills its progress bar from an int between 0 and
+		// 100, whatever the value hint scale.
+		if _, ok := notification.Hints["value"]; ok {
+			notification.Hints["value"] = dbus.MakeVariant(int(math.Round(min(max(percentage, 0), 100))))
+		}
+	case "gnome":
+		// GNOME Shell ignores both, and replaces notifications by ID.
+		delete(notification.Hints, "value")
+		delete(notification.Hints, "x-canonical-private-synchronous")
+	}
+}
+
+// valueHint encodes percentage for the "value" hint, either as an int from 0 to
+// 100 or as a float from 0 to 1 for daemons expecting that range.
+func (c *config) valueHint(percentage float64) dbus.Variant {
+	if c.valueHintScale == "0-1" {
+		return dbus.MakeVariant(percentage / 100)
+	}
+	return dbus.MakeVariant(int(math.Round(percentage)))
+}
+
+// urgencyBand maps battery levels at or below limit to urgency.
+type urgencyBand struct {
+	limit   float64
+	urgency notify.Urgency
+}
+
+// urgencies are the names of the urgencies accepted by --urgency.
+var urgencies = map[string]notify.Urgency{
+	"low":      notify.UrgencyLow,
+	"normal":   notify.UrgencyNormal,
+	"critical": notify.UrgencyCritical,
+}
+
+// eventUrgency returns the urgency set for ev with --urgency, or false when the
+// default of the event applies.
+func (c *config) eventUrgency(ev event) (notify.Urgency, bool) {
+	name, ok := c.urgencies[ev]
+	if !ok {
+		return 0, false
+	}
+	return urgencies[name], true
+}
+
+// urgency returns the urgency for a discharge notification at percentage, or
+// false when the level falls in no band and the server default should apply.
+func (c *config) urgency(percentage float64) (notify.Urgency, bool) {
+	bands := []urgencyBand{
+		{c.urgencyCriticalBelow, notify.UrgencyCritical},
+		{c.urgencyNormalBelow, notify.UrgencyNormal},
+		{c.urgencyLowBelow, notify.UrgencyLow},
+	}
+
+	// Unset bands follow the notification thresholds, except for the normal
+	// band which is disabled.
+	if bands[0].limit < 0 {
+		bands[0].limit = c.thresholdCritical
+	}
+	if bands[2].limit < 0 {
+		bands[2].limit = c.thresholdLow
+	}
+
+	for _, band := range bands {
+		if band.limit >= 0 && percentage <= band.limit {
+			return band.urgency, true
+		}
+	}
+
+	return 0, false
+}
+
+// iconName returns the icon from the freedesktop icon naming spec matching the
+// battery level and charging state.
+func iconName(percentage float64, charging bool) string {
+	var level string
+	switch {
+	case percentage < 10:
+		level = "caution"
+	case percentage < 30:
+		level = "low"
+	case percentage < 60:
+		level = "good"
+	default:
+		level = "full"
+	}
+
+	if charging {
+		return fmt.Sprintf("battery-%s-charging-symbolic", level)
+	}
+	return fmt.Sprintf("battery-%s-symbolic", level)
+}
+
+// runTest sends one notification for each event a few seconds apart, as told
+// by clk, so users can check how their notification daemon renders them.
+func runTest(ctx context.Context, cfg *config, clk clock) error {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	defer notifier.Close()
+
+	samples := []struct {
+		ev         event
+		percentage float64
+	}{
+		{eventLow, cfg.thresholdLow},
+		{eventCritical, cfg.thresholdCritical},
+		{eventFull, 100},
+	}
+
+	var lastNotificationID uint32
+
+	for i, sample := range samples {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-clk.After(3 * time.Second):
+			}
+		}
+
+		notification := cfg.newNotification(sample.ev, deviceTypeBattery, "Test", sample.percentage, 0)
+		notification.ReplacesID = lastNotificationID
+
+		slog.Info(fmt.Sprintf("Sending test notification. Battery level: %.0f%%", sample.percentage))
+		lastNotificationID, err = notifier.SendNotification(notification)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
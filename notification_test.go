@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValueHint(t *testing.T) {
+	tests := []struct {
+		scale      string
+		percentage float64
+		want       any
+	}{
+		{"0-100", 45.4, 45},
+		{"0-100", 45.5, 46},
+		{"0-100", 100, 100},
+		{"0-1", 45, 0.45},
+		{"0-1", 0, 0.0},
+		{"0-1", 100, 1.0},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, "--value-hint-scale", tt.scale)
+		if got := cfg.valueHint(tt.percentage).Value(); got != tt.want {
+			t.Errorf("valueHint(%g) with scale %s = %v (%T), want %v (%T)", tt.percentage, tt.scale, got, got, tt.want, tt.want)
+		}
+	}
+}
+
+func TestUrgencyHint(t *testing.T) {
+	tests := []struct {
+		name       string
+		ev         event
+		percentage float64
+		want       byte
+	}{
+		{"low", eventFull, 100, 0},
+		{"normal", eventCharger, 50, 1},
+		{"critical", eventCritical, 10, 2},
+	}
+
+	cfg := newTestConfig(t)
+	for _, tt := range tests {
+		notification := cfg.newNotification(tt.ev, deviceTypeBattery, "Test", tt.percentage, 0)
+		hint, ok := notification.Hints["urgency"]
+		if !ok {
+			t.Errorf("%s: no urgency hint", tt.name)
+			continue
+		}
+		// The specification types the urgency as a byte.
+		if sig := hint.Signature().String(); sig != "y" {
+			t.Errorf("%s: urgency hint of signature %q, want \"y\"", tt.name, sig)
+		}
+		if got, ok := hint.Value().(byte); !ok || got != tt.want {
+			t.Errorf("%s: urgency hint = %v (%T), want byte %d", tt.name, hint.Value(), hint.Value(), tt.want)
+		}
+	}
+}
+
+func TestNoValueHint(t *testing.T) {
+	for _, noValueHint := range []bool{false, true} {
+		cfg := newTestConfig(t, "--no-value-hint="+strconv.FormatBool(noValueHint))
+		for _, ev := range []event{eventLow, eventCritical, eventFull, eventDrain, eventStep} {
+			notification := cfg.newNotification(ev, deviceTypeBattery, "Test", 20, 0)
+			if _, ok := notification.Hints["value"]; ok == noValueHint {
+				t.Errorf("%s notification with --no-value-hint=%t has value hint %t", ev, noValueHint, ok)
+			}
+		}
+	}
+}
+
+func TestSynchronousHint(t *testing.T) {
+	cfg := newTestConfig(t, "--synchronous", "battery")
+	// Servers honoring the hint do not advertise it.
+	cfg.capabilities = map[string]bool{"body": true}
+	notification := cfg.newNotification(eventLow, deviceTypeBattery, "Test", 20, 0)
+	if got := notification.Hints["x-canonical-private-synchronous"].Value(); got != "battery" {
+		t.Errorf("synchronous hint = %v, want battery", got)
+	}
+}
+
+func TestFormatPercentage(t *testing.T) {
+	tests := []struct {
+		precision  int
+		percentage float64
+		want       string
+	}{
+		{0, 45, "45%"},
+		{0, 45.4, "45%"},
+		{0, 45.6, "46%"},
+		{0, 100, "100%"},
+		{0, 0, "0%"},
+		{1, 45, "45.0%"},
+		{1, 45.44, "45.4%"},
+		{1, 45.46, "45.5%"},
+		{1, 100, "100.0%"},
+		{1, 0, "0.0%"},
+	}
+
+	for _, tt := range tests {
+		cfg := newTestConfig(t, "--percentage-precision", strconv.Itoa(tt.precision))
+		if got := cfg.formatPercentage(tt.percentage); got != tt.want {
+			t.Errorf("formatPercentage(%g) with %d decimals = %q, want %q", tt.percentage, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestPercentagePrecisionInBody(t *testing.T) {
+	cfg := newTestConfig(t, "--percentage-precision", "1")
+	notification := cfg.newNotification(eventLow, deviceTypeBattery, "Test", 25.26, 0)
+	if !strings.Contains(notification.Body, "25.3%") {
+		t.Errorf("body = %q, want the level with one decimal", notification.Body)
+	}
+	// The value hint stays an integer.
+	if got := notification.Hints["value"].Value(); got != 25 {
+		t.Errorf("value hint = %v (%T), want 25", got, got)
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+// newNotifier returns the notifier sending notifications to the session bus
+// or, on multi-seat machines, to every session bus listed in cfg. The
+// capabilities of the notification server are read into cfg, and the urgency
+// copied to the hint named by cfg when set.
+func newNotifier(cfg *config) (notify.Notifier, error) {
+	notifier, err := openNotifier(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := readCapabilities(cfg, notifier); err != nil {
+		notifier.Close()
+		return nil, err
+	}
+
+	if cfg.urgencyHintKey != "" {
+		notifier = &urgencyKeyNotifier{Notifier: notifier, key: cfg.urgencyHintKey, only: cfg.urgencyHintOnly}
+	}
+
+	return notifier, nil
+}
+
+// openNotifier connects to the session buses. Each notifier has connections of
+// its own, rather than the shared one of dbus.SessionBus, as closing it when
+// the notifier is replaced would break the new notifier too.
+func openNotifier(cfg *config) (notify.Notifier, error) {
+	if cfg.sessionBuses == "" {
+		conn, err := dbus.ConnectSessionBus()
+		if err != nil {
+			return nil, fmt.Errorf("connecting to session bus: %w", err)
+		}
+		return newConnNotifier(conn, cfg.backend)
+	}
+
+	m := &multiNotifier{ids: map[uint32][]uint32{}}
+	for _, address := range strings.Split(cfg.sessionBuses, ",") {
+		address = strings.TrimSpace(address)
+		conn, err := dbus.Connect(address)
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("connecting to session bus %s: %w", address, err)
+		}
+
+		notifier, err := newConnNotifier(conn, cfg.backend)
+		if err != nil {
+			m.Close()
+			return nil, err
+		}
+		m.notifiers = append(m.notifiers, notifier)
+	}
+
+	return m, nil
+}
+
+// connNotifier is a notifier owning its bus connection.
+type connNotifier struct {
+	notify.Notifier
+	conn *dbus.Conn
+}
+
+// newConnNotifier returns the notifier of backend, either direct to talk to the
+// notification server or portal, on conn.
+func newConnNotifier(conn *dbus.Conn, backend string) (*connNotifier, error) {
+	if backend == "portal" {
+		return &connNotifier{Notifier: newPortalNotifier(conn), conn: conn}, nil
+	}
+
+	notifier, err := notify.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connecting to notification server: %w", err)
+	}
+	return &connNotifier{Notifier: notifier, conn: conn}, nil
+}
+
+func (n *connNotifier) Close() error {
+	return errors.Join(n.Notifier.Close(), n.conn.Close())
+}
+
+// urgencyKeyNotifier copies the urgency hint of notifications to another
+// hint, for notification servers reading the urgency under their own name.
+// With only set, the hint is moved rather than copied.
+type urgencyKeyNotifier struct {
+	notify.Notifier
+	key  string
+	only bool
+}
+
+func (n *urgencyKeyNotifier) SendNotification(notification notify.Notification) (uint32, error) {
+	if urgency, ok := notification.Hints["urgency"]; ok {
+		hints := maps.Clone(notification.Hints)
+		hints[n.key] = urgency
+		if n.only {
+			delete(hints, "urgency")
+		}
+		notification.Hints = hints
+	}
+	return n.Notifier.SendNotification(notification)
+}
+
+// multiNotifier fans notifications out to several notifiers. It hands out its
+// own IDs, each standing for the IDs returned by the wrapped notifiers. A
+// notification sent by one of them at least counts as sent.
+type multiNotifier struct {
+	notifiers []notify.Notifier
+	ids       map[uint32][]uint32
+	lastID    uint32
+}
+
+func (m *multiNotifier) SendNotification(n notify.Notification) (uint32, error) {
+	// The ID replaced is one of ours, standing for the IDs of the wrapped
+	// notifiers, which are what they are sent.
+	id := n.ReplacesID
+	replaced := m.ids[id]
+	ids := make([]uint32, len(m.notifiers))
+
+	var errs []error
+	for i, notifier := range m.notifiers {
+		n.ReplacesID = 0
+		if i < len(replaced) {
+			n.ReplacesID = replaced[i]
+		}
+
+		id, err := notifier.SendNotification(n)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		ids[i] = id
+	}
+
+	if len(errs) == len(m.notifiers) {
+		return 0, errors.Join(errs...)
+	}
+
+	if _, ok := m.ids[id]; !ok {
+		m.lastID++
+		id = m.lastID
+	}
+	m.ids[id] = ids
+
+	// The notification is shown on a seat at least, so it is sent and its ID
+	// kept for replacing it, and the seats it missed are only logged.
+	for _, err := range errs {
+		slog.Warn(fmt.Sprintf("A session missed the notification: %s", err))
+	}
+	return id, nil
+}
+
+func (m *multiNotifier) CloseNotification(id uint32) (bool, error) {
+	closed := false
+	var errs []error
+	for i, subID := range m.ids[id] {
+		if subID == 0 {
+			continue
+		}
+		ok, err := m.notifiers[i].CloseNotification(subID)
+		closed = closed || ok
+		errs = append(errs, err)
+	}
+	delete(m.ids, id)
+
+	return closed, errors.Join(errs...)
+}
+
+// GetCapabilities returns the capabilities supported by every server.
+func (m *multiNotifier) GetCapabilities() ([]string, error) {
+	var common []string
+	for i, notifier := range m.notifiers {
+		capabilities, err := notifier.GetCapabilities()
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			common = capabilities
+			continue
+		}
+		common = slices.DeleteFunc(common, func(c string) bool {
+			return !slices.Contains(capabilities, c)
+		})
+	}
+	return common, nil
+}
+
+// GetServerInformation returns the information of the first server.
+func (m *multiNotifier) GetServerInformation() (notify.ServerInformation, error) {
+	return m.notifiers[0].GetServerInformation()
+}
+
+func (m *multiNotifier) Close() error {
+	var errs []error
+	for _, notifier := range m.notifiers {
+		errs = append(errs, notifier.Close())
+	}
+	return errors.Join(errs...)
+}
+
+const notificationsService = "org.freedesktop.Notifications"
+
+// serverWatch tells when a new notification server takes over the session bus,
+// as happens when the server restarts or the compositor changes.
+type serverWatch struct {
+	conn    *dbus.Conn
+	signals chan *dbus.Signal
+	started chan struct{}
+}
+
+// watchNotificationServer watches the owner of the notifications service on
+// the session bus. It returns nil, watching nothing, with --session-bus or the
+// portal backend, whose notifiers outlive the server.
+func watchNotificationServer(cfg *config) (*serverWatch, error) {
+	if cfg.sessionBuses != "" || cfg.backend == "portal" {
+		return nil, nil
+	}
+
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connecting to session bus: %w", err)
+	}
+	if err := conn.AddMatchSignal(
+		dbus.WithMatchSender("org.freedesktop.DBus"),
+		dbus.WithMatchInterface("org.freedesktop.DBus"),
+		dbus.WithMatchMember("NameOwnerChanged"),
+		dbus.WithMatchArg(0, notificationsService),
+	); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("watching notification server: %w", err)
+	}
+
+	w := &serverWatch{
+		conn:    conn,
+		signals: make(chan *dbus.Signal, 1),
+		started: make(chan struct{}, 1),
+	}
+	conn.Signal(w.signals)
+	go func() {
+		for signal := range w.signals {
+			if isServerStart(signal) {
+				select {
+				case w.started <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+// isServerStart reports whether signal, a NameOwnerChanged signal, tells that
+// the notifications service got an owner.
+func isServerStart(signal *dbus.Signal) bool {
+	if len(signal.Body) < 3 {
+		return false
+	}
+	owner, _ := signal.Body[2].(string)
+	return owner != ""
+}
+
+// Started returns a channel receiving a value every time a notification server
+// starts, never receiving on a nil watch.
+func (w *serverWatch) Started() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.started
+}
+
+func (w *serverWatch) Close() error {
+	if w == nil {
+		return nil
+	}
+	return w.conn.Close()
+}
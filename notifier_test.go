@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+func TestMultiNotifierReplaces(t *testing.T) {
+	first, second := &fakeNotifier{}, &fakeNotifier{}
+	// The wrapped IDs must not be mistaken for ours.
+	second.lastID = 41
+	m := &multiNotifier{notifiers: []notify.Notifier{first, second}, ids: map[uint32][]uint32{}}
+
+	var id uint32
+	for i := range 3 {
+		got, err := m.SendNotification(notify.Notification{ReplacesID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > 0 && got != id {
+			t.Errorf("replacing %d returned %d, want the same ID", id, got)
+		}
+		id = got
+	}
+
+	if len(m.ids) != 1 {
+		t.Errorf("kept %d IDs, want 1: %v", len(m.ids), m.ids)
+	}
+	if ids := m.ids[id]; !slices.Equal(ids, []uint32{1, 42}) {
+		t.Errorf("ID %d stands for %v, want [1 42]", id, ids)
+	}
+	for i, notifier := range []*fakeNotifier{first, second} {
+		want := []uint32{1, 42}[i]
+		for j, sent := range notifier.sent[1:] {
+			if sent.ReplacesID != want {
+				t.Errorf("notifier %d: send %d replaced %d, want %d", i, j+2, sent.ReplacesID, want)
+			}
+		}
+	}
+
+	other, err := m.SendNotification(notify.Notification{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == id {
+		t.Errorf("a new notification got the ID %d of the existing one", id)
+	}
+
+	if _, err := m.CloseNotification(id); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(first.closed, []uint32{1}) || !slices.Equal(second.closed, []uint32{42}) {
+		t.Errorf("closed %v and %v, want [1] and [42]", first.closed, second.closed)
+	}
+	if _, ok := m.ids[id]; ok {
+		t.Errorf("ID %d kept after closing it", id)
+	}
+}
+
+func TestMultiNotifierErrors(t *testing.T) {
+	failing := &fakeNotifier{err: errors.New("no server")}
+	working := &fakeNotifier{}
+	m := &multiNotifier{notifiers: []notify.Notifier{failing, working}, ids: map[uint32][]uint32{}}
+
+	id, err := m.SendNotification(notify.Notification{})
+	if err != nil || id == 0 {
+		t.Fatalf("SendNotification() = %d, %v, want an ID and no error while a notifier works", id, err)
+	}
+
+	// The ID is kept, so that the notification shown is replaced rather
+	// than left behind.
+	if got, err := m.SendNotification(notify.Notification{ReplacesID: id}); err != nil || got != id {
+		t.Errorf("replacing %d = %d, %v, want the same ID", id, got, err)
+	}
+	if len(working.sent) != 2 || working.sent[1].ReplacesID != 1 {
+		t.Errorf("the working notifier got %v, want its notification 1 replaced", working.sent)
+	}
+
+	m.notifiers = []notify.Notifier{failing, failing}
+	if id, err := m.SendNotification(notify.Notification{}); err == nil || id != 0 {
+		t.Errorf("SendNotification() = %d, %v, want no ID and an error when every notifier fails", id, err)
+	}
+}
+
+func TestUrgencyKeyNotifier(t *testing.T) {
+	for _, only := range []bool{false, true} {
+		fake := &fakeNotifier{}
+		n := &urgencyKeyNotifier{Notifier: fake, key: "x-urgency", only: only}
+		var notification notify.Notification
+		notification.SetUrgency(notify.UrgencyCritical)
+		if _, err := n.SendNotification(notification); err != nil {
+			t.Fatal(err)
+		}
+
+		hints := fake.sent[0].Hints
+		if got, _ := hints["x-urgency"].Value().(byte); notify.Urgency(got) != notify.UrgencyCritical {
+			t.Errorf("with only %t, x-urgency hint = %v, want critical", only, hints["x-urgency"])
+		}
+		if _, ok := hints["urgency"]; ok == only {
+			t.Errorf("with only %t, urgency hint sent %t", only, ok)
+		}
+		// The notification of the caller is left as is.
+		if _, ok := notification.Hints["x-urgency"]; ok {
+			t.Errorf("with only %t, the hints of the notification sent were changed", only)
+		}
+	}
+}
+
+func TestIsServerStart(t *testing.T) {
+	tests := []struct {
+		name string
+		body []any
+		want bool
+	}{
+		{"started", []any{notificationsService, "", ":1.42"}, true},
+		{"replaced", []any{notificationsService, ":1.41", ":1.42"}, true},
+		{"exited", []any{notificationsService, ":1.41", ""}, false},
+		{"short body", []any{notificationsService}, false},
+		{"invalid owner", []any{notificationsService, "", 42}, false},
+	}
+
+	for _, tt := range tests {
+		signal := &dbus.Signal{Name: "org.freedesktop.DBus.NameOwnerChanged", Body: tt.body}
+		if got := isServerStart(signal); got != tt.want {
+			t.Errorf("%s: isServerStart(%v) = %t, want %t", tt.name, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// runProbe prints every property of the monitored devices as JSON, for
+// attaching to bug reports.
+func runProbe(cfg *config) error {
+	sysConn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("connecting to system bus: %w", err)
+	}
+	defer sysConn.Close()
+
+	var reports []map[string]any
+	for _, path := range cfg.devicePaths() {
+		properties, err := deviceProperties(sysConn, path)
+		if err != nil {
+			return err
+		}
+
+		report := map[string]any{
+			"Path": path,
+		}
+		for name, variant := range properties {
+			report[name] = variant.Value()
+		}
+		if state, ok := properties["State"].Value().(uint32); ok {
+			report["StateName"] = stateName(state)
+		}
+		reports = append(reports, report)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if len(reports) == 1 {
+		return encoder.Encode(reports[0])
+	}
+	return encoder.Encode(reports)
+}
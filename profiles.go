@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// powerProfilesServices lists the bus names and paths of power-profiles-daemon,
+// newest first.
+var powerProfilesServices = []struct {
+	name string
+	path dbus.ObjectPath
+}{
+	{"org.freedesktop.UPower.PowerProfiles", "/org/freedesktop/UPower/PowerProfiles"},
+	{"net.hadess.PowerProfiles", "/net/hadess/PowerProfiles"},
+}
+
+// profileLevels is a flag holding a battery level per power profile, set as
+// "profile=level".
+type profileLevels map[string]float64
+
+func (m *profileLevels) String() string {
+	if m == nil {
+		return ""
+	}
+	var pairs []string
+	for profile, level := range *m {
+		pairs = append(pairs, fmt.Sprintf("%s=%g", profile, level))
+	}
+	slices.Sort(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *profileLevels) Set(value string) error {
+	profile, value, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected PROFILE=LEVEL, got %q", profile)
+	}
+	level, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("invalid level %q for profile %s", value, profile)
+	}
+	if *m == nil {
+		*m = profileLevels{}
+	}
+	(*m)[profile] = level
+	return nil
+}
+
+// withProfile returns a copy of c using the thresholds set for the power
+// profile, if any.
+func (c *config) withProfile(profile string) *config {
+	profiled := *c
+	if level, ok := c.profileLow[profile]; ok {
+		profiled.thresholdLow = level
+	}
+	if level, ok := c.profileCritical[profile]; ok {
+		profiled.thresholdCritical = level
+	}
+	return &profiled
+}
+
+// activePowerProfile returns the path of the power-profiles-daemon object and
+// its active profile, or an error if the daemon is not running.
+func activePowerProfile(conn *dbus.Conn) (dbus.ObjectPath, string, error) {
+	var err error
+	for _, service := range powerProfilesServices {
+		var profile string
+		err = conn.Object(service.name, service.path).Call(dbusCallPropertiesGet, 0, service.name, "ActiveProfile").Store(&profile)
+		if err == nil {
+			return service.path, profile, nil
+		}
+	}
+	return "", "", err
+}
@@ -0,0 +1,48 @@
+package main
+
+import "time"
+
+// rateWindow keeps the last few discharge rates of a device to smooth the
+// time to empty, which jumps around with the instantaneous rate.
+type rateWindow struct {
+	size    int
+	samples []float64
+}
+
+// add records rate in watts, dropping the oldest sample once the window is full.
+func (w *rateWindow) add(rate float64) {
+	if rate <= 0 {
+		return
+	}
+	if len(w.samples) == w.size {
+		w.samples = w.samples[1:]
+	}
+	w.samples = append(w.samples, rate)
+}
+
+// reset forgets every sample, e.g. when the device stops discharging.
+func (w *rateWindow) reset() {
+	w.samples = w.samples[:0]
+}
+
+// mean returns the average of the samples, or 0 when there are none.
+func (w *rateWindow) mean() float64 {
+	if len(w.samples) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, rate := range w.samples {
+		sum += rate
+	}
+	return sum / float64(len(w.samples))
+}
+
+// timeLeft returns the time until a battery holding energy, in watt-hours, is
+// empty at the average rate, or 0 when unknown like UPower does.
+func (w *rateWindow) timeLeft(energy float64) time.Duration {
+	rate := w.mean()
+	if rate == 0 {
+		return 0
+	}
+	return time.Duration(energy / rate * float64(time.Hour))
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateWindow(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		rates []float64
+		mean  float64
+	}{
+		{"empty", 3, nil, 0},
+		{"one sample", 3, []float64{10}, 10},
+		{"averaged", 3, []float64{10, 20, 30}, 20},
+		{"oldest evicted", 3, []float64{100, 10, 20, 30}, 20},
+		{"non-positive ignored", 3, []float64{10, 0, -5, 20}, 15},
+		{"only non-positive", 3, []float64{0, -1}, 0},
+	}
+
+	for _, tt := range tests {
+		w := rateWindow{size: tt.size}
+		for _, rate := range tt.rates {
+			w.add(rate)
+		}
+		if got := w.mean(); got != tt.mean {
+			t.Errorf("%s: mean() = %g, want %g", tt.name, got, tt.mean)
+		}
+		if len(w.samples) > tt.size {
+			t.Errorf("%s: kept %d samples, want at most %d", tt.name, len(w.samples), tt.size)
+		}
+	}
+}
+
+func TestRateWindowTimeLeft(t *testing.T) {
+	w := rateWindow{size: 2}
+	if got := w.timeLeft(40); got != 0 {
+		t.Errorf("timeLeft() without samples = %s, want 0", got)
+	}
+
+	w.add(8)
+	w.add(12)
+	if got, want := w.timeLeft(40), 4*time.Hour; got != want {
+		t.Errorf("timeLeft(40) at 10 W = %s, want %s", got, want)
+	}
+	if got, want := w.timeLeft(5), 30*time.Minute; got != want {
+		t.Errorf("timeLeft(5) at 10 W = %s, want %s", got, want)
+	}
+
+	w.reset()
+	if got := w.timeLeft(40); got != 0 {
+		t.Errorf("timeLeft() after reset = %s, want 0", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+
+	"github.com/esiqveland/notify"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	login1UserInterface    = "org.freedesktop.login1.User"
+	login1SessionInterface = "org.freedesktop.login1.Session"
+	dbusCallGetUser        = login1ManagerInterface + ".GetUser"
+)
+
+// displaySession returns the logind session of the user shown on screen, the
+// one whose lock state matters, along with whether it is locked.
+func displaySession(conn *dbus.Conn) (dbus.ObjectPath, bool, error) {
+	var userPath dbus.ObjectPath
+	if err := conn.Object(login1Service, login1Path).Call(dbusCallGetUser, 0, uint32(os.Getuid())).Store(&userPath); err != nil {
+		return "", false, fmt.Errorf("finding logind user: %w", err)
+	}
+
+	variant, err := conn.Object(login1Service, userPath).GetProperty(login1UserInterface + ".Display")
+	if err != nil {
+		return "", false, fmt.Errorf("finding graphical session: %w", err)
+	}
+	display, ok := variant.Value().([]any)
+	if !ok || len(display) < 2 {
+		return "", false, fmt.Errorf("finding graphical session: unexpected Display %v", variant)
+	}
+	path, _ := display[1].(dbus.ObjectPath)
+	if path == "/" || path == "" {
+		return "", false, fmt.Errorf("finding graphical session: user has none")
+	}
+
+	variant, err = conn.Object(login1Service, path).GetProperty(login1SessionInterface + ".LockedHint")
+	if err != nil {
+		return "", false, fmt.Errorf("reading session lock state: %w", err)
+	}
+	locked, _ := variant.Value().(bool)
+	return path, locked, nil
+}
+
+// queuedNotification is a notification held back while the screen is locked.
+type queuedNotification struct {
+	d            *device
+	ev           event
+	notification notify.Notification
+	percentage   float64
+	state        uint32
+}
+
+// setLocked records whether the screen is locked, sending the notifications
+// held back once it is unlocked.
+func (m *monitor) setLocked(locked bool) {
+	if locked == m.locked {
+		return
+	}
+	m.locked = locked
+	if locked {
+		slog.Info("Screen locked, holding back notifications")
+		return
+	}
+
+	slog.Info(fmt.Sprintf("Screen unlocked, sending %d held back notifications", len(m.queued)))
+	if m.summaryHeld {
+		m.updateSummary()
+	}
+	queued := m.queued
+	m.queued = nil
+	for _, q := range queued {
+		sent, err := m.send(q.d, q.ev, q.notification, q.percentage, q.state)
+		if err != nil {
+			slog.Error(err.Error())
+		}
+		// The low level held back is notified now.
+		if sent && (q.ev == eventLow || q.ev == eventCritical) {
+			q.d.notified, q.d.notifiedAt = q.ev, m.clock.Now()
+		}
+	}
+}
+
+// dropHeldBack forgets the notifications held back for d, which closing its
+// notifications makes outdated.
+func (m *monitor) dropHeldBack(d *device) {
+	m.queued = slices.DeleteFunc(m.queued, func(q queuedNotification) bool {
+		return q.d == d
+	})
+}
+
+// holdBack queues notification for ev about d, at percentage and in state,
+// while the screen is locked, replacing what was queued under the same key.
+// Critical notifications are never held back.
+func (m *monitor) holdBack(d *device, ev event, notification notify.Notification, percentage float64, state uint32) bool {
+	if !m.locked {
+		return false
+	}
+	if urgency, _ := notification.Hints["urgency"].Value().(byte); notify.Urgency(urgency) == notify.UrgencyCritical {
+		return false
+	}
+
+	key := m.notificationKey(ev)
+	for i, q := range m.queued {
+		if q.d == d && m.notificationKey(q.ev) == key {
+			m.queued[i] = queuedNotification{d, ev, notification, percentage, state}
+			return true
+		}
+	}
+	m.queued = append(m.queued, queuedNotification{d, ev, notification, percentage, state})
+	return true
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// droppingSignalHandler delivers signals to the registered channels without
+// blocking. Unlike the godbus default handler, which keeps signals for a full
+// channel in a goroutine each, signals that do not fit are dropped and
+// reported on overflow so that the state can be read again from the bus.
+type droppingSignalHandler struct {
+	mu     sync.Mutex
+	chans  []chan<- *dbus.Signal
+	closed bool
+
+	overflow chan struct{}
+}
+
+func newDroppingSignalHandler() *droppingSignalHandler {
+	return &droppingSignalHandler{overflow: make(chan struct{}, 1)}
+}
+
+func (h *droppingSignalHandler) DeliverSignal(iface, name string, signal *dbus.Signal) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ch := range h.chans {
+		select {
+		case ch <- signal:
+		default:
+			select {
+			case h.overflow <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (h *droppingSignalHandler) AddSignal(ch chan<- *dbus.Signal) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.closed {
+		h.chans = append(h.chans, ch)
+	}
+}
+
+func (h *droppingSignalHandler) RemoveSignal(ch chan<- *dbus.Signal) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i := len(h.chans) - 1; i >= 0; i-- {
+		if h.chans[i] == ch {
+			h.chans = append(h.chans[:i], h.chans[i+1:]...)
+		}
+	}
+}
+
+// Terminate closes the registered channels once the connection is closed.
+func (h *droppingSignalHandler) Terminate() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+	for _, ch := range h.chans {
+		close(ch)
+	}
+	h.chans = nil
+	h.closed = true
+}
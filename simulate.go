@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// runSimulate feeds the monitor a full discharge from 100% to 0%, one percent
+// per tick, sending the resulting notifications. It needs no battery and only
+// uses the session bus, which makes it handy for theming and testing.
+func runSimulate(ctx context.Context, cfg *config) error {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+	defer notifier.Close()
+
+	path := cfg.devicePaths()[0]
+	m := newMonitor(simulatedConfig(cfg), nil, notifier, []dbus.ObjectPath{path})
+
+	ticker := m.clock.NewTicker(cfg.simulateTick)
+	defer ticker.Stop()
+
+	for percentage := 100.0; percentage >= 0; percentage-- {
+		slog.Info(fmt.Sprintf("Simulating battery level: %.0f%%", percentage))
+		m.handleChanges(ctx, path, simulatedProperties(cfg, percentage))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.Chan():
+		}
+	}
+
+	return nil
+}
+
+// simulatedConfig returns cfg without the settings needing a real battery.
+// There is no system bus to ask for line power, the warning level nor the
+// screen lock, and no sysfs battery, and hooks and the journal must not act on
+// a fake battery.
+func simulatedConfig(cfg *config) *config {
+	simulated := *cfg
+	simulated.suppressOnAC = false
+	simulated.notifyCharger = false
+	simulated.useWarningLevel = false
+	simulated.suppressLocked = false
+	simulated.panicExec = ""
+	simulated.hooks = nil
+	simulated.beepCritical = false
+	simulated.inhibitIdle = false
+	simulated.journalEvents = false
+	simulated.fifo = ""
+	simulated.source = "upower"
+	return &simulated
+}
+
+// simulatedProperties returns every device property read by the monitor for a
+// battery discharging at percentage, so that it never reads from the bus.
+func simulatedProperties(cfg *config, percentage float64) map[string]dbus.Variant {
+	// Assume a 50 Wh battery, unless told otherwise, lasting five hours
+	// from full.
+	capacity := cfg.fullEnergy
+	if capacity == 0 {
+		capacity = 50
+	}
+	timeToEmpty := int64(percentage / 100 * 5 * 60 * 60)
+
+	return map[string]dbus.Variant{
+		"IsPresent":   dbus.MakeVariant(true),
+		"Model":       dbus.MakeVariant("Simulated"),
+		"State":       dbus.MakeVariant(stateDischarging),
+		"Percentage":  dbus.MakeVariant(percentage),
+		"Energy":      dbus.MakeVariant(percentage / 100 * capacity),
+		"EnergyRate":  dbus.MakeVariant(capacity / 5),
+		"TimeToEmpty": dbus.MakeVariant(timeToEmpty),
+	}
+}
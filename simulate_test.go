@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestSimulateReadsNoBus(t *testing.T) {
+	// Every flag changing what the monitor reads, which would panic reading
+	// from the missing system bus.
+	cfg := newTestConfig(t,
+		"--use-warning-level", "--suppress-on-ac", "--notify-charger", "--suppress-when-locked",
+		"--rate-window", "5", "--battery-full-design", "50", "--source", "sysfs",
+		"--critical-time", "10m", "--notify-every", "10", "--drain-drop", "5",
+		"--charge-limit", "80", "--show-time-to-full", "--show-charge-rate", "--notify-removed",
+		"--notify-full", "--inhibit-idle", "--beep-critical", "--panic-exec", "true",
+	)
+	notifier := &fakeNotifier{}
+	m := newMonitor(simulatedConfig(cfg), nil, notifier, []dbus.ObjectPath{testDevice})
+
+	for percentage := 100.0; percentage >= 0; percentage-- {
+		m.handleChanges(t.Context(), testDevice, simulatedProperties(cfg, percentage))
+	}
+
+	if len(notifier.sent) == 0 {
+		t.Error("the simulated discharge sent no notification")
+	}
+}
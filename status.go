@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+)
+
+// runStatus prints a line describing the current state of each device.
+func runStatus(cfg *config) error {
+	sysConn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("connecting to system bus: %w", err)
+	}
+	defer sysConn.Close()
+
+	color := cfg.useColor(os.Stdout)
+	for _, path := range cfg.devicePaths() {
+		properties, err := deviceProperties(sysConn, path)
+		if err != nil {
+			return err
+		}
+
+		model, _ := properties["Model"].Value().(string)
+		percentage, _ := properties["Percentage"].Value().(float64)
+		state, _ := properties["State"].Value().(uint32)
+		timeToEmpty, _ := properties["TimeToEmpty"].Value().(int64)
+
+		timeLeft := time.Duration(timeToEmpty) * time.Second
+		fmt.Println(cfg.formatStatus(cfg.modelName(path, model), cfg.calibrate(percentage), state, timeLeft, color))
+	}
+
+	return nil
+}
+
+// formatStatus describes the device in a line such as "BAT0: 45% Discharging,
+// 2h10m left", coloring the level by the thresholds when color is set. The
+// time left is omitted when zero, that is unknown.
+func (c *config) formatStatus(model string, percentage float64, state uint32, timeLeft time.Duration, color bool) string {
+	level := c.formatPercentage(percentage)
+	if color {
+		code := ansiGreen
+		switch {
+		case percentage <= c.thresholdCritical:
+			code = ansiRed
+		case percentage <= c.thresholdLow:
+			code = ansiYellow
+		}
+		level = code + level + ansiReset
+	}
+
+	status := fmt.Sprintf("%s: %s %s", model, level, c.msgs.state(state))
+	if timeLeft > 0 {
+		status += ", " + fmt.Sprintf(c.msgs.timeLeft, formatDuration(timeLeft, c.durationFormat))
+	}
+	return status
+}
+
+// useColor reports whether output written to f should be colored.
+func (c *config) useColor(f *os.File) bool {
+	switch c.color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// checkStep sends a low urgency notification every time d drops by another
+// step while discharging, whatever the thresholds. The first reading of a
+// discharge only sets the step the level is in.
+func (m *monitor) checkStep(ctx context.Context, d *device, obj dbus.BusObject, path dbus.ObjectPath, properties map[string]dbus.Variant, percentage float64, timeLeft time.Duration) {
+	state, err := m.deviceState(ctx, d, obj, properties)
+	if err != nil {
+		slog.Error(err.Error())
+		return
+	}
+
+	if state != stateDischarging {
+		d.stepped = false
+		return
+	}
+
+	step := int(math.Ceil(percentage / m.cfg.notifyEvery))
+	if !d.stepped || step > d.step {
+		d.stepped, d.step = true, step
+		return
+	}
+	if step == d.step {
+		return
+	}
+	d.step = step
+	slog.Info(fmt.Sprintf("Battery dropped to %.0f%%", percentage))
+
+	var model string
+	if err := deviceProperty(obj, properties, "Model", &model); err != nil {
+		slog.Error(err.Error())
+	}
+	model = m.cfg.modelName(path, model)
+
+	notification := m.cfg.newNotification(eventStep, d.deviceType, model, percentage, timeLeft)
+	if _, err := m.send(d, eventStep, notification, percentage, state); err != nil {
+		slog.Error(err.Error())
+	}
+	m.journal(eventStep, notification, percentage, state)
+	runHooks(ctx, m.cfg.hooks, eventStep, percentage, state)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"math"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// powerSupplyPath is where the kernel exposes batteries and chargers.
+const powerSupplyPath = "/sys/class/power_supply"
+
+// readCapacity returns the battery level reported by the kernel for the power
+// supply called name, e.g. BAT0, bypassing the smoothing done by UPower.
+func readCapacity(name string) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(powerSupplyPath, name, "capacity"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+}
+
+// writeChargeThreshold makes the firmware stop charging the power supply called
+// name at percent. Writing the attribute needs root.
+func writeChargeThreshold(name string, percent int) error {
+	path := filepath.Join(powerSupplyPath, name, "charge_control_end_threshold")
+	return os.WriteFile(path, []byte(strconv.Itoa(percent)), 0o644)
+}
+
+// sysfsStates maps the status attribute of batteries to UPower states.
+var sysfsStates = map[string]uint32{
+	"Unknown":      stateUnknown,
+	"Charging":     stateCharging,
+	"Discharging":  stateDischarging,
+	"Not charging": statePendingCharge,
+	"Full":         stateFullyCharged,
+}
+
+// readAttribute returns the attribute attr of the power supply called name.
+func readAttribute(name, attr string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(powerSupplyPath, name, attr))
+	return strings.TrimSpace(string(data)), err
+}
+
+// readMicros returns the attribute attr in base units, as the kernel reports
+// energy, power, charge, current and voltage in millionths.
+func readMicros(name, attr string) (float64, bool) {
+	value, err := readAttribute(name, attr)
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	return n / 1e6, err == nil
+}
+
+// sysfsBatteries returns the UPower object paths of the laptop batteries in
+// sysfs, that is the batteries powering the system rather than a peripheral.
+func sysfsBatteries() ([]dbus.ObjectPath, error) {
+	entries, err := os.ReadDir(powerSupplyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []dbus.ObjectPath
+	for _, entry := range entries {
+		name := entry.Name()
+		if typ, _ := readAttribute(name, "type"); typ != "Battery" {
+			continue
+		}
+		if scope, _ := readAttribute(name, "scope"); scope == "Device" {
+			continue
+		}
+		paths = append(paths, dbus.ObjectPath(devicesPath+"battery_"+name))
+	}
+
+	if len(paths) == 0 {
+		return nil, errors.New("no battery found in " + powerSupplyPath)
+	}
+	return paths, nil
+}
+
+// readPowerSupply returns the UPower properties read by the monitor, filled
+// in from the attributes of the power supply called name.
+func readPowerSupply(name string) (map[string]dbus.Variant, error) {
+	capacity, err := readCapacity(name)
+	if err != nil {
+		return nil, err
+	}
+
+	status, _ := readAttribute(name, "status")
+	model, _ := readAttribute(name, "model_name")
+	present := true
+	if value, err := readAttribute(name, "present"); err == nil {
+		present = value == "1"
+	}
+
+	// Batteries report either energy and power, or charge and current.
+	energy, ok := readMicros(name, "energy_now")
+	if !ok {
+		charge, _ := readMicros(name, "charge_now")
+		voltage, _ := readMicros(name, "voltage_now")
+		energy = charge * voltage
+	}
+	full, ok := readMicros(name, "energy_full")
+	if !ok {
+		charge, _ := readMicros(name, "charge_full")
+		voltage, _ := readMicros(name, "voltage_now")
+		full = charge * voltage
+	}
+	rate, ok := readMicros(name, "power_now")
+	if !ok {
+		current, _ := readMicros(name, "current_now")
+		voltage, _ := readMicros(name, "voltage_now")
+		rate = current * voltage
+	}
+	rate = math.Abs(rate)
+
+	state := sysfsStates[status]
+	var timeToEmpty int64
+	if state == stateDischarging && rate > 0 {
+		timeToEmpty = int64(energy / rate * 60 * 60)
+	}
+	var timeToFull int64
+	if state == stateCharging && rate > 0 && full > energy {
+		timeToFull = int64((full - energy) / rate * 60 * 60)
+	}
+
+	return map[string]dbus.Variant{
+		"IsPresent":   dbus.MakeVariant(present),
+		"Model":       dbus.MakeVariant(model),
+		"State":       dbus.MakeVariant(state),
+		"Percentage":  dbus.MakeVariant(capacity),
+		"Energy":      dbus.MakeVariant(energy),
+		"EnergyRate":  dbus.MakeVariant(rate),
+		"TimeToEmpty": dbus.MakeVariant(timeToEmpty),
+		"TimeToFull":  dbus.MakeVariant(timeToFull),
+	}, nil
+}
+
+// changedProperties returns the properties that differ between previous and
+// current, like a PropertiesChanged signal would. Every property is returned
+// when any changed, so that the monitor never reads from the bus, except for
+// Percentage which the monitor takes as the sign that the level changed.
+func changedProperties(previous, current map[string]dbus.Variant) map[string]dbus.Variant {
+	changed := false
+	for name, value := range current {
+		if !reflect.DeepEqual(previous[name], value) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	properties := maps.Clone(current)
+	if reflect.DeepEqual(previous["Percentage"], current["Percentage"]) {
+		delete(properties, "Percentage")
+	}
+	return properties
+}
+
+// watchUevents sends the name of a power supply to names whenever the kernel
+// reports a change of it, until ctx is done. Sysfs attributes never trigger
+// inotify events, but power supply drivers emit a uevent on changes.
+func watchUevents(ctx context.Context, names chan<- string) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_DGRAM|syscall.SOCK_CLOEXEC, syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return err
+	}
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+
+	// A non-blocking file is handled by the runtime poller, so closing it
+	// interrupts a pending read.
+	if err := syscall.SetNonblock(fd, true); err != nil {
+		syscall.Close(fd)
+		return err
+	}
+	f := os.NewFile(uintptr(fd), "uevent")
+
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 8192)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+
+			var subsystem, name string
+			for _, field := range strings.Split(string(buf[:n]), "\x00") {
+				key, value, _ := strings.Cut(field, "=")
+				switch key {
+				case "SUBSYSTEM":
+					subsystem = value
+				case "POWER_SUPPLY_NAME":
+					name = value
+				}
+			}
+
+			if subsystem == "power_supply" && name != "" {
+				select {
+				case names <- name:
+				default:
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// runSysfsOnly monitors the batteries through sysfs alone, for systems without
+// UPower, reading them again on uevents or, with --source acpi, on ACPI
+// events. Neither is emitted for every change of the level, so the batteries
+// are also read every sysfs poll interval.
+func runSysfsOnly(ctx context.Context, cfg *config) error {
+	notifier, err := newNotifier(cfg)
+	if err != nil {
+		return err
+	}
+
+	m := newMonitor(cfg, nil, notifier, cfg.devicePaths())
+	defer func() {
+		m.notifier.Close()
+	}()
+	if cfg.chargeThreshold > 0 {
+		m.setChargeThresholds()
+	}
+
+	names := make(chan string, cfg.signalBuffer)
+	watchEvents := watchUevents
+	if cfg.source == "acpi" {
+		watchEvents = watchACPIEvents
+	}
+	if err := watchEvents(ctx, names); err != nil {
+		return err
+	}
+
+	ticker := m.clock.NewTicker(cfg.sysfsPoll)
+	defer ticker.Stop()
+
+	previous := map[dbus.ObjectPath]map[string]dbus.Variant{}
+	read := func(d *device) {
+		current, err := readPowerSupply(d.nativePath)
+		if err != nil {
+			slog.Error(err.Error())
+			return
+		}
+		if properties := changedProperties(previous[d.path], current); properties != nil {
+			m.handleChanges(ctx, d.path, properties)
+		}
+		previous[d.path] = current
+	}
+
+	for _, d := range m.devices {
+		read(d)
+	}
+
+	slog.Info("Listening for changes in sysfs")
+
+	if err := sdNotify("READY=1"); err != nil {
+		slog.Error(err.Error())
+	}
+
+	watch, err := watchNotificationServer(cfg)
+	if err != nil {
+		return err
+	}
+	defer watch.Close()
+
+	pause := make(chan os.Signal, 1)
+	signal.Notify(pause, syscall.SIGUSR1)
+	defer signal.Stop(pause)
+
+	var reminders <-chan time.Time
+	if cfg.chargeLimit > 0 && cfg.limitRepeat > 0 {
+		ticker := m.clock.NewTicker(cfg.limitRepeat)
+		defer ticker.Stop()
+		reminders = ticker.Chan()
+	}
+
+	var watchdog <-chan time.Time
+	if interval := watchdogInterval(); interval > 0 {
+		ticker := m.clock.NewTicker(interval)
+		defer ticker.Stop()
+		watchdog = ticker.Chan()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Quitting")
+			return nil
+		case <-watchdog:
+			if err := sdNotify("WATCHDOG=1"); err != nil {
+				slog.Error(err.Error())
+			}
+		case <-reminders:
+			m.remindChargeLimit()
+		case <-pause:
+			m.togglePause()
+		case <-watch.Started():
+			slog.Info("The notification server started, reconnecting to it")
+			m.reopenNotifier(cfg)
+		case name := <-names:
+			for _, d := range m.devices {
+				if name == "" || d.nativePath == name {
+					read(d)
+				}
+			}
+		case <-ticker.Chan():
+			for _, d := range m.devices {
+				read(d)
+			}
+		}
+	}
+}
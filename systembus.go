@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	login1Service          = "org.freedesktop.login1"
+	login1Path             = "/org/freedesktop/login1"
+	login1ManagerInterface = "org.freedesktop.login1.Manager"
+	login1PrepareForSleep  = login1ManagerInterface + ".PrepareForSleep"
+)
+
+// systemBus is a connection to the system bus subscribed to the changes of
+// the monitored devices and, when used, of the power profile.
+type systemBus struct {
+	conn    *dbus.Conn
+	handler *droppingSignalHandler
+	signals chan *dbus.Signal
+
+	// profilesPath is the power-profiles-daemon object, empty when thresholds
+	// do not depend on the power profile.
+	profilesPath dbus.ObjectPath
+	profile      string
+
+	// sessionPath is the logind session whose lock state is followed, empty
+	// unless notifications are held back while it is locked.
+	sessionPath dbus.ObjectPath
+	locked      bool
+}
+
+// connectSystemBus connects to the system bus and subscribes to the signals
+// needed for cfg.
+func connectSystemBus(cfg *config) (*systemBus, error) {
+	handler := newDroppingSignalHandler()
+	conn, err := dbus.ConnectSystemBus(dbus.WithSignalHandler(handler))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to system bus: %w", err)
+	}
+
+	if err := pingUPower(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	bus := &systemBus{
+		conn:    conn,
+		handler: handler,
+		signals: make(chan *dbus.Signal, cfg.signalBuffer),
+	}
+	conn.Signal(bus.signals)
+
+	for _, path := range cfg.devicePaths() {
+		if err := watchProperties(conn, path); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("watching %s: %w", path, err)
+		}
+	}
+
+	if cfg.notifyOnResume {
+		if err := conn.AddMatchSignal(
+			dbus.WithMatchObjectPath(login1Path),
+			dbus.WithMatchInterface(login1ManagerInterface),
+			dbus.WithMatchMember("PrepareForSleep"),
+		); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("watching suspend: %w", err)
+		}
+	}
+
+	if cfg.suppressLocked {
+		path, locked, err := displaySession(conn)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("The screen lock state is not available, notifying while locked: %s", err))
+		} else if err := watchProperties(conn, path); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("watching session: %w", err)
+		} else {
+			bus.sessionPath, bus.locked = path, locked
+		}
+	}
+
+	if len(cfg.profileLow) > 0 || len(cfg.profileCritical) > 0 {
+		path, profile, err := activePowerProfile(conn)
+		if err != nil {
+			slog.Info("Power profiles are not available, using the default thresholds")
+			return bus, nil
+		}
+
+		if err := watchProperties(conn, path); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("watching power profile: %w", err)
+		}
+		bus.profilesPath, bus.profile = path, profile
+	}
+
+	return bus, nil
+}
+
+// reconnectSystemBus connects to the system bus again, waiting on clk longer
+// after each failed attempt. It only fails once ctx is done.
+func reconnectSystemBus(ctx context.Context, cfg *config, clk clock) (*systemBus, error) {
+	b := backoff{base: time.Second, max: cfg.reconnectMax}
+
+	for attempt := 1; ; attempt++ {
+		delay := b.next()
+		slog.Info(fmt.Sprintf("Reconnecting to the system bus in %s. Attempt: %d", delay.Round(time.Millisecond), attempt))
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-clk.After(delay):
+		}
+
+		bus, err := connectSystemBus(cfg)
+		if err == nil {
+			return bus, nil
+		}
+		slog.Error(err.Error())
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	upowerPath               = dbus.ObjectPath("/org/freedesktop/UPower")
+	dbusCallEnumerateDevices = "org.freedesktop.UPower.EnumerateDevices"
+
+	// displayDeviceName is the composite device UPower keeps for the
+	// desktop, combining the level of every laptop battery.
+	displayDeviceName = "DisplayDevice"
+)
+
+// UPower device types, as reported by the Type property.
+const (
+	deviceTypeLinePower uint32 = 1
+	deviceTypeBattery   uint32 = 2
+	deviceTypeUPS       uint32 = 3
+	deviceTypeMouse     uint32 = 5
+	deviceTypeKeyboard  uint32 = 6
+	deviceTypePhone     uint32 = 8
+	deviceTypeTablet    uint32 = 10
+	deviceTypeGaming    uint32 = 12
+	deviceTypePen       uint32 = 13
+	deviceTypeTouchpad  uint32 = 14
+	deviceTypeHeadset   uint32 = 17
+	deviceTypeSpeakers  uint32 = 18
+	deviceTypeHeadphone uint32 = 19
+)
+
+var deviceLabels = map[uint32]string{
+	deviceTypeUPS:       "UPS",
+	deviceTypeMouse:     "Mouse",
+	deviceTypeKeyboard:  "Keyboard",
+	deviceTypePhone:     "Phone",
+	deviceTypeTablet:    "Tablet",
+	deviceTypeGaming:    "Controller",
+	deviceTypePen:       "Pen",
+	deviceTypeTouchpad:  "Touchpad",
+	deviceTypeHeadset:   "Headset",
+	deviceTypeSpeakers:  "Speakers",
+	deviceTypeHeadphone: "Headphones",
+}
+
+// deviceLabel names the kind of device in notifications, defaulting to
+// "Battery" for laptop batteries and unknown types.
+func deviceLabel(deviceType uint32) string {
+	if label, ok := deviceLabels[deviceType]; ok {
+		return label
+	}
+	return "Battery"
+}
+
+// deviceProperty stores the UPower device property name into v. The value is
+// taken from changed, the properties carried by a PropertiesChanged signal,
+// when present, and read from the bus otherwise.
+func deviceProperty(obj dbus.BusObject, changed map[string]dbus.Variant, name string, v any) error {
+	if variant, exists := changed[name]; exists {
+		return variant.Store(v)
+	}
+	return obj.Call(dbusCallPropertiesGet, 0, dbusUPowerDeviceInterface, name).Store(v)
+}
+
+const (
+	propertyRetries    = 3
+	propertyRetryDelay = 200 * time.Millisecond
+)
+
+// retryProperty is deviceProperty retried a few times on failure, for reads
+// that would otherwise drop an alert while UPower briefly restarts. Values
+// carried by the signal never fail, so only reads from the bus are retried,
+// waiting on clk between attempts.
+func retryProperty(ctx context.Context, clk clock, obj dbus.BusObject, changed map[string]dbus.Variant, name string, v any) error {
+	err := deviceProperty(obj, changed, name, v)
+	for attempt := 1; err != nil && attempt < propertyRetries; attempt++ {
+		slog.Warn(fmt.Sprintf("Reading %s failed, retrying: %s", name, err))
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-clk.After(propertyRetryDelay):
+		}
+
+		err = deviceProperty(obj, changed, name, v)
+	}
+	return err
+}
+
+// errUPowerUnavailable is wrapped by the errors caused by UPower not running.
+var errUPowerUnavailable = errors.New("UPower is not available")
+
+// upowerError wraps errUPowerUnavailable around err when the UPower service is
+// missing from the bus.
+func upowerError(err error) error {
+	var dbusErr dbus.Error
+	if errors.As(err, &dbusErr) && dbusErr.Name == "org.freedesktop.DBus.Error.ServiceUnknown" {
+		return fmt.Errorf("%w: %w", errUPowerUnavailable, err)
+	}
+	return err
+}
+
+// pingUPower checks that UPower runs, starting it if it is bus-activated.
+func pingUPower(conn *dbus.Conn) error {
+	if err := conn.Object(dbusUPowerService, upowerPath).Call("org.freedesktop.DBus.Peer.Ping", 0).Err; err != nil {
+		return upowerError(err)
+	}
+	return nil
+}
+
+// deviceProperties returns every property of the UPower device at path.
+func deviceProperties(conn *dbus.Conn, path dbus.ObjectPath) (map[string]dbus.Variant, error) {
+	var properties map[string]dbus.Variant
+	err := conn.Object(dbusUPowerService, path).Call(dbusCallPropertiesGetAll, 0, dbusUPowerDeviceInterface).Store(&properties)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, upowerError(err))
+	}
+	return properties, nil
+}
+
+// watchProperties subscribes conn to the PropertiesChanged signals of the
+// object at path.
+func watchProperties(conn *dbus.Conn, path dbus.ObjectPath) error {
+	return conn.AddMatchSignal(
+		dbus.WithMatchInterface("org.freedesktop.DBus.Properties"),
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchMember("PropertiesChanged"),
+	)
+}
+
+// devicesOfType returns the object paths of the UPower devices of type typ.
+func devicesOfType(conn *dbus.Conn, typ uint32) ([]dbus.ObjectPath, error) {
+	var paths []dbus.ObjectPath
+	if err := conn.Object(dbusUPowerService, upowerPath).Call(dbusCallEnumerateDevices, 0).Store(&paths); err != nil {
+		return nil, err
+	}
+
+	var matching []dbus.ObjectPath
+	for _, path := range paths {
+		var deviceType uint32
+		if err := deviceProperty(conn.Object(dbusUPowerService, path), nil, "Type", &deviceType); err != nil {
+			return nil, err
+		}
+		if deviceType == typ {
+			matching = append(matching, path)
+		}
+	}
+
+	return matching, nil
+}
+
+// battery is a laptop battery found by primaryBattery.
+type battery struct {
+	path       dbus.ObjectPath
+	energyFull float64
+}
+
+// laptopBatteries returns the laptop batteries UPower lists, that is the
+// batteries powering the system rather than a peripheral. Batteries are found
+// by type, as kernels name them BAT0, BAT1, CMB0 or after their ACPI ID.
+func laptopBatteries(conn *dbus.Conn) ([]battery, error) {
+	paths, err := devicesOfType(conn, deviceTypeBattery)
+	if err != nil {
+		return nil, err
+	}
+
+	var batteries []battery
+	for _, path := range paths {
+		properties, err := deviceProperties(conn, path)
+		if err != nil {
+			return nil, err
+		}
+		if powerSupply, _ := properties["PowerSupply"].Value().(bool); !powerSupply {
+			continue
+		}
+		energyFull, _ := properties["EnergyFull"].Value().(float64)
+		batteries = append(batteries, battery{path: path, energyFull: energyFull})
+	}
+
+	return batteries, nil
+}
+
+// primaryBattery returns the laptop battery UPower lists, choosing the one
+// holding the most energy when full if there are several.
+func primaryBattery(conn *dbus.Conn) (dbus.ObjectPath, error) {
+	batteries, err := laptopBatteries(conn)
+	if err != nil {
+		return "", err
+	}
+
+	path, ok := selectPrimary(batteries)
+	if !ok {
+		return "", errors.New("no battery found")
+	}
+
+	paths := make([]dbus.ObjectPath, len(batteries))
+	for i, b := range batteries {
+		paths[i] = b.path
+	}
+	logSkipped(paths, path)
+	return path, nil
+}
+
+// logSkipped logs the batteries of paths left out for the primary one, as a
+// second battery going unmonitored is easily missed.
+func logSkipped(paths []dbus.ObjectPath, primary dbus.ObjectPath) {
+	for _, path := range paths {
+		if path != primary {
+			slog.Info(fmt.Sprintf("Not monitoring %s, use --device all to monitor every battery", path))
+		}
+	}
+}
+
+// selectPrimary returns the battery of batteries holding the most energy when
+// full, the first of them on a tie.
+func selectPrimary(batteries []battery) (dbus.ObjectPath, bool) {
+	if len(batteries) == 0 {
+		return "", false
+	}
+	primary := batteries[0]
+	for _, b := range batteries[1:] {
+		if b.energyFull > primary.energyFull {
+			primary = b
+		}
+	}
+	return primary.path, true
+}
+
+// autoDevice returns the devices monitored for --device auto, the primary
+// battery, or --device all, every laptop battery. Without UPower they are read
+// from sysfs, where the primary battery is the first one. BAT0 is assumed
+// when no battery is found.
+func autoDevice(cfg *config) string {
+	var paths []dbus.ObjectPath
+	var err error
+	if cfg.withoutUPower() {
+		paths, err = sysfsBatteries()
+		if cfg.device == "auto" && len(paths) > 0 {
+			logSkipped(paths, paths[0])
+			paths = paths[:1]
+		}
+	} else {
+		var conn *dbus.Conn
+		conn, err = dbus.SystemBus()
+		if err == nil {
+			paths, err = upowerBatteries(conn, cfg.device == "all")
+			conn.Close()
+		}
+	}
+
+	if err == nil && len(paths) == 0 {
+		err = errors.New("no battery found")
+	}
+	if err != nil {
+		slog.Warn(fmt.Sprintf("Could not find the battery, using BAT0: %s", err))
+		return "battery_BAT0"
+	}
+
+	names := make([]string, len(paths))
+	for i, path := range paths {
+		slog.Info(fmt.Sprintf("Monitoring %s", path))
+		names[i] = string(path)
+	}
+	return strings.Join(names, ",")
+}
+
+// upowerBatteries returns the primary battery, or every laptop battery when
+// all is set.
+func upowerBatteries(conn *dbus.Conn, all bool) ([]dbus.ObjectPath, error) {
+	if !all {
+		path, err := primaryBattery(conn)
+		if err != nil {
+			return nil, err
+		}
+		return []dbus.ObjectPath{path}, nil
+	}
+
+	batteries, err := laptopBatteries(conn)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]dbus.ObjectPath, len(batteries))
+	for i, b := range batteries {
+		paths[i] = b.path
+	}
+	return paths, nil
+}
+
+// linePowerOnline reports whether any line power device, such as an AC
+// adapter, is online.
+func linePowerOnline(conn *dbus.Conn) (bool, error) {
+	paths, err := devicesOfType(conn, deviceTypeLinePower)
+	if err != nil {
+		return false, err
+	}
+
+	for _, path := range paths {
+		var online bool
+		if err := deviceProperty(conn.Object(dbusUPowerService, path), nil, "Online", &online); err != nil {
+			return false, err
+		}
+		if online {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
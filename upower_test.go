@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestDevicePropertyFromSignal(t *testing.T) {
+	// Without a connection, any read from the bus would panic.
+	var conn *dbus.Conn
+	obj := conn.Object(dbusUPowerService, testDevice)
+	changed := map[string]dbus.Variant{
+		"State":      dbus.MakeVariant(stateDischarging),
+		"Percentage": dbus.MakeVariant(42.0),
+	}
+
+	var state uint32
+	if err := deviceProperty(obj, changed, "State", &state); err != nil {
+		t.Fatal(err)
+	}
+	if state != stateDischarging {
+		t.Errorf("State = %d, want %d", state, stateDischarging)
+	}
+
+	var percentage float64
+	if err := deviceProperty(obj, changed, "Percentage", &percentage); err != nil {
+		t.Fatal(err)
+	}
+	if percentage != 42 {
+		t.Errorf("Percentage = %g, want 42", percentage)
+	}
+}
+
+// flakyObject is a device failing the first reads of its properties.
+type flakyObject struct {
+	dbus.BusObject
+	failures int
+	calls    int
+	state    uint32
+}
+
+func (o *flakyObject) Call(method string, flags dbus.Flags, args ...any) *dbus.Call {
+	o.calls++
+	if o.calls <= o.failures {
+		return &dbus.Call{Err: dbus.ErrClosed}
+	}
+	return &dbus.Call{Body: []any{dbus.MakeVariant(o.state)}}
+}
+
+// retryState runs retryProperty for the State of obj, advancing clk over the
+// delays between attempts.
+func retryState(t *testing.T, obj dbus.BusObject, clk *fakeClock) (uint32, error) {
+	t.Helper()
+
+	var state uint32
+	done := make(chan error)
+	go func() {
+		done <- retryProperty(t.Context(), clk, obj, nil, "State", &state)
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			return state, err
+		default:
+		}
+		if clk.Waiters() > 0 {
+			clk.Advance(propertyRetryDelay)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRetryPropertyTransientFailure(t *testing.T) {
+	obj := &flakyObject{failures: propertyRetries - 1, state: stateDischarging}
+	state, err := retryState(t, obj, newFakeClock(time.Now()))
+	if err != nil {
+		t.Fatalf("retryProperty() = %v, want the read to succeed on the last attempt", err)
+	}
+	if state != stateDischarging {
+		t.Errorf("State = %d, want %d", state, stateDischarging)
+	}
+	if obj.calls != propertyRetries {
+		t.Errorf("read %d times, want %d", obj.calls, propertyRetries)
+	}
+}
+
+func TestRetryPropertyPersistentFailure(t *testing.T) {
+	obj := &flakyObject{failures: propertyRetries}
+	if _, err := retryState(t, obj, newFakeClock(time.Now())); !errors.Is(err, dbus.ErrClosed) {
+		t.Errorf("retryProperty() = %v, want %v", err, dbus.ErrClosed)
+	}
+	if obj.calls != propertyRetries {
+		t.Errorf("read %d times, want %d", obj.calls, propertyRetries)
+	}
+}
+
+func TestRetryPropertyFromSignal(t *testing.T) {
+	obj := &flakyObject{failures: propertyRetries}
+	changed := map[string]dbus.Variant{"State": dbus.MakeVariant(stateCharging)}
+
+	var state uint32
+	if err := retryProperty(t.Context(), newFakeClock(time.Now()), obj, changed, "State", &state); err != nil {
+		t.Fatal(err)
+	}
+	if state != stateCharging || obj.calls != 0 {
+		t.Errorf("State = %d after %d reads, want %d from the signal without reads", state, obj.calls, stateCharging)
+	}
+}
+
+func TestUPowerError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"service unknown", dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"}, true},
+		{"wrapped service unknown", fmt.Errorf("reading: %w", dbus.Error{Name: "org.freedesktop.DBus.Error.ServiceUnknown"}), true},
+		{"unknown method", dbus.Error{Name: "org.freedesktop.DBus.Error.UnknownMethod"}, false},
+		{"closed connection", dbus.ErrClosed, false},
+	}
+
+	for _, tt := range tests {
+		err := upowerError(tt.err)
+		if got := errors.Is(err, errUPowerUnavailable); got != tt.want {
+			t.Errorf("%s: errors.Is(%v, errUPowerUnavailable) = %t, want %t", tt.name, err, got, tt.want)
+		}
+		if !strings.Contains(err.Error(), tt.err.Error()) {
+			t.Errorf("%s: %v lost the error of the bus, %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestLogSkipped(t *testing.T) {
+	buf := captureLogs(t)
+	bat0 := dbus.ObjectPath(devicesPath + "battery_BAT0")
+	bat1 := dbus.ObjectPath(devicesPath + "battery_BAT1")
+
+	logSkipped([]dbus.ObjectPath{bat0, bat1}, bat1)
+	if logs := buf.String(); !strings.Contains(logs, "Not monitoring "+string(bat0)) || strings.Contains(logs, string(bat1)) {
+		t.Errorf("logged %q, want only %s skipped", logs, bat0)
+	}
+}
+
+func TestSelectPrimary(t *testing.T) {
+	bat0 := dbus.ObjectPath(devicesPath + "battery_BAT0")
+	bat1 := dbus.ObjectPath(devicesPath + "battery_BAT1")
+	bat2 := dbus.ObjectPath(devicesPath + "battery_BAT2")
+
+	tests := []struct {
+		name      string
+		batteries []battery
+		want      dbus.ObjectPath
+		ok        bool
+	}{
+		{"none", nil, "", false},
+		{"one", []battery{{path: bat0, energyFull: 50}}, bat0, true},
+		{"largest first", []battery{{path: bat0, energyFull: 57}, {path: bat1, energyFull: 23}}, bat0, true},
+		{"largest last", []battery{{path: bat0, energyFull: 23}, {path: bat1, energyFull: 24}, {path: bat2, energyFull: 57}}, bat2, true},
+		{"tie", []battery{{path: bat0, energyFull: 23}, {path: bat1, energyFull: 57}, {path: bat2, energyFull: 57}}, bat1, true},
+		{"unknown energy", []battery{{path: bat0}, {path: bat1}}, bat0, true},
+	}
+
+	for _, tt := range tests {
+		got, ok := selectPrimary(tt.batteries)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s: selectPrimary() = %s, %t, want %s, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// commands lists the commands shown in the help output, leaving out the ones
+// meant for development.
+var commands = []struct {
+	name, help string
+}{
+	{"test", "Send a sample notification for each event and exit."},
+	{"status", "Print the level and state of the device and exit."},
+	{"probe", "Print the properties of the device as JSON and exit."},
+	{"health", "Print the capacity, cycle count and health of the device and exit."},
+	{"completion", "Print the completion script for bash, zsh or fish and exit."},
+}
+
+type flagGroup struct {
+	title string
+	names []string
+}
+
+// flagGroups sorts the flags into sections of the help output. Flags missing
+// from here are listed under "Other" so that every flag is documented.
+var flagGroups = []flagGroup{
+	{"Device", []string{
+		"device", "display-device", "model", "source", "sysfs-poll", "signal-buffer", "reconnect-max",
+		"single-instance", "allow-root", "config",
+	}},
+	{"Thresholds", []string{
+		"low", "critical", "desktop-thresholds", "use-warning-level", "profile-low", "profile-critical",
+		"critical-time", "rate-window", "confirm-readings",
+		"trigger", "repeat-every", "hysteresis",
+		"notify-every", "drain-drop", "drain-window", "charge-limit", "charge-limit-repeat",
+		"show-time-to-full", "show-charge-rate",
+		"suppress-on-ac",
+		"battery-full-design", "calibrate-offset", "calibrate-scale",
+		"charge-threshold-set",
+	}},
+	{"Notifications", []string{
+		"session-bus", "backend",
+		"urgency", "urgency-low-below", "urgency-normal-below", "urgency-critical-below",
+		"use-theme-icons", "app-icon", "synchronous", "category", "critical-resident", "markup",
+		"max-summary-length", "max-body-length",
+		"notify-removed", "notify-full", "notify-charger", "notify-on-resume", "close-states",
+		"suppress-when-locked",
+		"consolidate", "notification-policy", "value-hint-scale", "no-value-hint",
+		"percentage-precision", "percent-in-summary",
+		"daemon-profile", "sound", "hint", "urgency-hint-key",
+		"urgency-hint-only",
+		"daily-summary-at",
+	}},
+	{"Output", []string{
+		"history-file", "fifo", "journal-events", "min-percentage-delta-for-log",
+		"color", "duration-format", "state-name", "follow", "dump-capabilities",
+	}},
+	{"Hooks", []string{
+		"panic-threshold", "panic-exec", "hook",
+		"beep-critical", "beep-interval", "inhibit-idle",
+	}},
+}
+
+// printUsage writes the help output for the flags defined in fs to w.
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s [command] [flags]\n\nCommands:\n", appName)
+	for _, command := range commands {
+		fmt.Fprintf(w, "  %-10s  %s\n", command.name, command.help)
+	}
+
+	// Single letter flags are shorthands of the long flag sharing their value.
+	shorthands := map[string]string{}
+	isShorthand := map[string]bool{}
+	fs.VisitAll(func(short *flag.Flag) {
+		if len(short.Name) != 1 {
+			return
+		}
+		fs.VisitAll(func(long *flag.Flag) {
+			if len(long.Name) > 1 && long.Value == short.Value {
+				shorthands[long.Name] = short.Name
+				isShorthand[short.Name] = true
+			}
+		})
+	})
+
+	var other []string
+	fs.VisitAll(func(f *flag.Flag) {
+		if isShorthand[f.Name] {
+			return
+		}
+		for _, group := range flagGroups {
+			if slices.Contains(group.names, f.Name) {
+				return
+			}
+		}
+		other = append(other, f.Name)
+	})
+
+	groups := flagGroups
+	if len(other) > 0 {
+		groups = append(slices.Clip(groups), flagGroup{"Other", other})
+	}
+
+	for _, group := range groups {
+		fmt.Fprintf(w, "\n%s:\n", group.title)
+		for _, name := range group.names {
+			f := fs.Lookup(name)
+			if f == nil {
+				continue
+			}
+
+			var b strings.Builder
+			if short, ok := shorthands[name]; ok {
+				fmt.Fprintf(&b, "  -%s, --%s", short, name)
+			} else {
+				fmt.Fprintf(&b, "      --%s", name)
+			}
+
+			typ, help := flag.UnquoteUsage(f)
+			if typ != "" {
+				fmt.Fprintf(&b, " %s", typ)
+			}
+			fmt.Fprintf(&b, "\n        %s", help)
+			if !isZeroDefault(f) {
+				fmt.Fprintf(&b, " (default %s)", f.DefValue)
+			}
+
+			fmt.Fprintln(w, b.String())
+		}
+	}
+}
+
+// isZeroDefault reports whether the default of f is not worth showing.
+func isZeroDefault(f *flag.Flag) bool {
+	switch f.DefValue {
+	case "", "0", "0s", "false":
+		return true
+	default:
+		return false
+	}
+}